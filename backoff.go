@@ -0,0 +1,73 @@
+package firehose
+
+import (
+	"math/rand"
+	"time"
+)
+
+// A Backoff decides how long to wait before each attempt to reconnect.
+type Backoff interface {
+	// Next returns the delay before the given reconnection attempt, counting from 1.
+	Next(attempt int) time.Duration
+	// Reset is called once a connection has succeeded in delivering messages, after which the attempts are counted
+	// from 1 again.
+	Reset()
+}
+
+// BackoffFunc adapts a function to the Backoff interface. Reset does nothing.
+type BackoffFunc func(attempt int) time.Duration
+
+// Next calls f(attempt).
+func (f BackoffFunc) Next(attempt int) time.Duration { return f(attempt) }
+
+// Reset does nothing.
+func (f BackoffFunc) Reset() {}
+
+// An ExponentialBackoff is a Backoff whose delay grows exponentially with each attempt up to a maximum, with random
+// jitter so that many clients disconnected by the same outage do not all reconnect at the same moment.
+//
+// The delay before attempt n is Initial * Multiplier^(n-1), capped at Max, and then reduced by a random fraction of up
+// to Jitter of itself.
+type ExponentialBackoff struct {
+	// Initial is the delay before the first attempt. If zero, one second is used.
+	Initial time.Duration
+	// Max is the longest delay. If zero, one minute is used.
+	Max time.Duration
+	// Multiplier is the factor by which the delay grows with each attempt. If less than one, two is used.
+	Multiplier float64
+	// Jitter is the largest fraction by which each delay is randomly reduced, between zero for no jitter and one.
+	Jitter float64
+}
+
+// DefaultBackoff returns the Backoff used by a ResilientStream without one: starting at one second and doubling with
+// each attempt up to a minute, with up to half of each delay removed at random.
+func DefaultBackoff() *ExponentialBackoff {
+	return &ExponentialBackoff{Initial: time.Second, Max: time.Minute, Multiplier: 2, Jitter: 0.5}
+}
+
+// Next returns the delay before the given attempt.
+func (b *ExponentialBackoff) Next(attempt int) time.Duration {
+	initial, limit, multiplier := b.Initial, b.Max, b.Multiplier
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if limit <= 0 {
+		limit = time.Minute
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(limit); i++ {
+		d *= multiplier
+	}
+	d = min(d, float64(limit))
+	if jitter := min(max(b.Jitter, 0), 1); jitter > 0 {
+		d -= d * jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Reset does nothing, since the delay depends only on the attempt number.
+func (b *ExponentialBackoff) Reset() {}
@@ -0,0 +1,76 @@
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &firehose.ExponentialBackoff{Initial: time.Second, Max: 5 * time.Second, Multiplier: 2}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := b.Next(attempt + 1); d != want {
+			t.Errorf("attempt %d: expected %s, got %s", attempt+1, want, d)
+		}
+	}
+
+	var zero firehose.ExponentialBackoff
+	if d := zero.Next(1); d != time.Second {
+		t.Errorf("expected zero value to start at one second, got %s", d)
+	}
+	if d := zero.Next(100); d != time.Minute {
+		t.Errorf("expected zero value to be capped at one minute, got %s", d)
+	}
+
+	jittered := firehose.DefaultBackoff()
+	for i := 0; i < 100; i++ {
+		if d := jittered.Next(3); d < 2*time.Second || d > 4*time.Second {
+			t.Fatalf("jittered delay out of range: %s", d)
+		}
+	}
+}
+
+// recordingBackoff records the attempts it is asked about and how often it is reset.
+type recordingBackoff struct {
+	attempts []int
+	resets   int
+}
+
+func (b *recordingBackoff) Next(attempt int) time.Duration {
+	b.attempts = append(b.attempts, attempt)
+	return 0
+}
+
+func (b *recordingBackoff) Reset() { b.resets++ }
+
+func TestResilientStreamBackoff(t *testing.T) {
+	srv := &fakeServer{
+		t:     t,
+		inits: make(chan string, 4),
+		sessions: [][]string{
+			{`{"type":"position","ident":"A","pitr":"1001"}`},
+			{},
+			{},
+			{`{"type":"error","error_msg":"Invalid username or password"}`},
+		},
+	}
+	backoff := &recordingBackoff{}
+	rs := &firehose.ResilientStream{
+		Command: firehose.InitCommand{Live: true, Username: "user", Password: "pass"},
+		Dial:    srv.dial,
+		Backoff: backoff,
+	}
+	err := rs.Run(context.Background(), func(*firehose.Message) error { return nil })
+	if !errors.Is(err, firehose.ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got: %v", err)
+	}
+	if len(backoff.attempts) != 3 || backoff.attempts[0] != 1 || backoff.attempts[1] != 2 || backoff.attempts[2] != 3 {
+		t.Errorf("unexpected attempts: %v", backoff.attempts)
+	}
+	if backoff.resets != 1 {
+		t.Errorf("expected one reset after the session which delivered a message, got %d", backoff.resets)
+	}
+}
@@ -0,0 +1,79 @@
+package firehose_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+// capture returns a recording of n position messages in the Firehose framing.
+func capture(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, `{"type":"position","ident":"UAL%d","lat":"42.36","lon":"-71.01","clock":"1596067800",`+
+			`"id":"UAL%d-1596000000-airline-0001","updateType":"A","air_ground":"A","alt":"35000","gs":"450",`+
+			`"heading":"271","pitr":"%d"}`+"\n", i, i, 1596067800+i)
+	}
+	return buf.Bytes()
+}
+
+// readCounter counts the reads made from the underlying reader, each of which would be a system call on a connection.
+type readCounter struct {
+	r     io.Reader
+	reads int
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
+func BenchmarkReadBufferSize(b *testing.B) {
+	data := capture(1000)
+	for _, size := range []int{4 << 10, firehose.DefaultReadBufferSize} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			reads := 0
+			for i := 0; i < b.N; i++ {
+				src := &readCounter{r: bytes.NewReader(data)}
+				stream := firehose.NewReader(src, firehose.WithReadBufferSize(size))
+				for {
+					if _, err := stream.NextMessage(context.Background()); err != nil {
+						break
+					}
+				}
+				reads += src.reads
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+func BenchmarkNextMessage(b *testing.B) {
+	data := capture(1000)
+	b.Run("Retain", func(b *testing.B) {
+		benchmarkNextMessage(b, data, func(*firehose.Message) {})
+	})
+	b.Run("Release", func(b *testing.B) {
+		benchmarkNextMessage(b, data, firehose.ReleaseMessage)
+	})
+}
+
+func benchmarkNextMessage(b *testing.B, data []byte, done func(*firehose.Message)) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		stream := firehose.NewReader(bytes.NewReader(data))
+		for {
+			msg, err := stream.NextMessage(context.Background())
+			if err != nil {
+				break
+			}
+			done(msg)
+		}
+	}
+}
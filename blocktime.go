@@ -0,0 +1,159 @@
+package firehose
+
+import (
+	"sync"
+	"time"
+)
+
+// TaxiPhase identifies which part of a flight's ground movement a TaxiTime measures.
+type TaxiPhase int
+
+const (
+	// TaxiOut is the time from leaving the gate (offblock) to departure.
+	TaxiOut TaxiPhase = iota + 1
+	// TaxiIn is the time from arrival to reaching the gate (onblock).
+	TaxiIn
+)
+
+// String returns a human-readable name for the phase.
+func (p TaxiPhase) String() string {
+	switch p {
+	case TaxiOut:
+		return "taxi-out"
+	case TaxiIn:
+		return "taxi-in"
+	default:
+		return "unknown"
+	}
+}
+
+// A TaxiTime is a measured taxi duration for a flight.
+type TaxiTime struct {
+	// ID is the FlightAware Flight ID.
+	ID string
+	// Phase indicates whether this is a taxi-out or taxi-in time.
+	Phase TaxiPhase
+	// Start is the offblock time for taxi-out, or the arrival time for taxi-in.
+	Start time.Time
+	// End is the departure time for taxi-out, or the onblock time for taxi-in.
+	End time.Time
+}
+
+// Duration returns the time spent taxiing.
+func (t TaxiTime) Duration() time.Duration {
+	return t.End.Sub(t.Start)
+}
+
+// A BlockTimeTracker pairs gate and runway events by flight ID to measure taxi-out and taxi-in times.
+//
+// A TaxiTime is emitted only once both of its ends have been recorded, in whichever order they arrive. Once a flight's
+// taxi-in time has been emitted its state is discarded; flights which never reach the gate can be discarded with
+// Forget.
+//
+// A BlockTimeTracker is safe for concurrent use, and the callback is invoked without holding its lock.
+type BlockTimeTracker struct {
+	mu      sync.Mutex
+	flights map[string]*blockTimes
+	onTaxi  func(TaxiTime)
+}
+
+// blockTimes holds the events recorded so far for a flight. Zero values have not been recorded.
+type blockTimes struct {
+	offBlock, departure, arrival, onBlock time.Time
+}
+
+// NewBlockTimeTracker creates an empty BlockTimeTracker.
+func NewBlockTimeTracker() *BlockTimeTracker {
+	return &BlockTimeTracker{
+		flights: make(map[string]*blockTimes),
+	}
+}
+
+// OnTaxiTime registers a callback which is invoked with each taxi time as it is measured.
+func (b *BlockTimeTracker) OnTaxiTime(fn func(TaxiTime)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onTaxi = fn
+}
+
+// Observe records the offblock, departure, arrival, or onblock time reported by a message. Other messages are ignored.
+func (b *BlockTimeTracker) Observe(msg *Message) {
+	switch m := msg.Payload.(type) {
+	case DepartureMessage:
+		if at, err := parseEpoch(m.ADT); err == nil {
+			b.RecordDeparture(m.ID, at)
+		}
+	case ArrivalMessage:
+		if at, err := parseEpoch(m.AAT); err == nil {
+			b.RecordArrival(m.ID, at)
+		}
+	case SurfaceOffblockMessage:
+		if at, err := parseEpoch(m.Clock); err == nil {
+			b.RecordOffBlock(m.ID, at)
+		}
+	case SurfaceOnblockMessage:
+		if at, err := parseEpoch(m.Clock); err == nil {
+			b.RecordOnBlock(m.ID, at)
+		}
+	}
+}
+
+// RecordOffBlock records the time at which the flight left the gate.
+func (b *BlockTimeTracker) RecordOffBlock(id string, at time.Time) {
+	b.record(id, func(t *blockTimes) { t.offBlock = at })
+}
+
+// RecordDeparture records the time at which the flight departed.
+func (b *BlockTimeTracker) RecordDeparture(id string, at time.Time) {
+	b.record(id, func(t *blockTimes) { t.departure = at })
+}
+
+// RecordArrival records the time at which the flight arrived.
+func (b *BlockTimeTracker) RecordArrival(id string, at time.Time) {
+	b.record(id, func(t *blockTimes) { t.arrival = at })
+}
+
+// RecordOnBlock records the time at which the flight reached the gate.
+func (b *BlockTimeTracker) RecordOnBlock(id string, at time.Time) {
+	b.record(id, func(t *blockTimes) { t.onBlock = at })
+}
+
+// Forget discards all state for the flight with the given ID.
+func (b *BlockTimeTracker) Forget(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.flights, id)
+}
+
+func (b *BlockTimeTracker) record(id string, set func(*blockTimes)) {
+	if id == "" {
+		return
+	}
+
+	var emit []TaxiTime
+
+	b.mu.Lock()
+	t, ok := b.flights[id]
+	if !ok {
+		t = &blockTimes{}
+		b.flights[id] = t
+	}
+	hadOut := !t.offBlock.IsZero() && !t.departure.IsZero()
+	set(t)
+	if !hadOut && !t.offBlock.IsZero() && !t.departure.IsZero() {
+		emit = append(emit, TaxiTime{ID: id, Phase: TaxiOut, Start: t.offBlock, End: t.departure})
+	}
+	if !t.arrival.IsZero() && !t.onBlock.IsZero() {
+		emit = append(emit, TaxiTime{ID: id, Phase: TaxiIn, Start: t.arrival, End: t.onBlock})
+		delete(b.flights, id)
+	}
+	onTaxi := b.onTaxi
+	b.mu.Unlock()
+
+	if onTaxi == nil {
+		return
+	}
+	for _, taxi := range emit {
+		onTaxi(taxi)
+	}
+}
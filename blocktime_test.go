@@ -0,0 +1,91 @@
+package firehose_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestBlockTimeTracker(t *testing.T) {
+	b := firehose.NewBlockTimeTracker()
+	var times []firehose.TaxiTime
+	b.OnTaxiTime(func(tt firehose.TaxiTime) {
+		times = append(times, tt)
+	})
+
+	base := time.Unix(1000000, 0)
+	b.RecordOffBlock("f1", base)
+	if len(times) != 0 {
+		t.Fatalf("unexpected taxi time with only offblock recorded: %#v", times)
+	}
+	b.RecordDeparture("f1", base.Add(12*time.Minute))
+	b.RecordArrival("f1", base.Add(90*time.Minute))
+	b.RecordOnBlock("f1", base.Add(97*time.Minute))
+
+	if len(times) != 2 {
+		t.Fatalf("expected 2 taxi times, got %#v", times)
+	}
+	if times[0].Phase != firehose.TaxiOut || times[0].Duration() != 12*time.Minute {
+		t.Errorf("unexpected taxi-out: %s %v", times[0].Phase, times[0].Duration())
+	}
+	if times[1].Phase != firehose.TaxiIn || times[1].Duration() != 7*time.Minute {
+		t.Errorf("unexpected taxi-in: %s %v", times[1].Phase, times[1].Duration())
+	}
+}
+
+func TestBlockTimeTrackerUnpaired(t *testing.T) {
+	b := firehose.NewBlockTimeTracker()
+	var times []firehose.TaxiTime
+	b.OnTaxiTime(func(tt firehose.TaxiTime) {
+		times = append(times, tt)
+	})
+
+	base := time.Unix(1000000, 0)
+	// The onblock arriving before the arrival is still paired.
+	b.RecordOnBlock("f1", base.Add(5*time.Minute))
+	b.RecordDeparture("f2", base)
+	b.RecordArrival("f1", base)
+
+	if len(times) != 1 || times[0].ID != "f1" || times[0].Phase != firehose.TaxiIn {
+		t.Fatalf("unexpected taxi times: %#v", times)
+	}
+}
+
+func TestBlockTimeTrackerObserve(t *testing.T) {
+	b := firehose.NewBlockTimeTracker()
+	var times []firehose.TaxiTime
+	b.OnTaxiTime(func(tt firehose.TaxiTime) {
+		times = append(times, tt)
+	})
+	b.RecordOffBlock("f1", time.Unix(1000, 0))
+	b.Observe(&firehose.Message{Type: "departure", Payload: firehose.DepartureMessage{ID: "f1", ADT: "1600"}})
+	if len(times) != 1 || times[0].Duration() != 10*time.Minute {
+		t.Errorf("unexpected taxi times: %#v", times)
+	}
+}
+
+func TestBlockTimeTrackerObserveSurface(t *testing.T) {
+	b := firehose.NewBlockTimeTracker()
+	var times []firehose.TaxiTime
+	b.OnTaxiTime(func(tt firehose.TaxiTime) {
+		times = append(times, tt)
+	})
+	for _, data := range []string{
+		`{"type":"surface_offblock","id":"f1","ident":"UAL1","airport":"KSFO","clock":"1000","gate":"G92","pitr":"1001"}`,
+		`{"type":"departure","id":"f1","adt":"1600"}`,
+		`{"type":"arrival","id":"f1","aat":"9000"}`,
+		`{"type":"surface_onblock","id":"f1","ident":"UAL1","airport":"KBOS","clock":"9300"}`,
+	} {
+		var msg firehose.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		b.Observe(&msg)
+	}
+	if len(times) != 2 || times[0].Phase != firehose.TaxiOut || times[0].Duration() != 10*time.Minute ||
+		times[1].Phase != firehose.TaxiIn || times[1].Duration() != 5*time.Minute {
+		t.Errorf("unexpected taxi times: %#v", times)
+	}
+}
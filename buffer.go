@@ -0,0 +1,90 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// A messageBuffer is the state of a Stream's background decoder, which is used with WithBuffer.
+type messageBuffer struct {
+	once   sync.Once
+	ch     chan bufferedMessage
+	cancel context.CancelFunc
+	done   chan struct{}
+	// err is the error which stopped the decoder. It is set before ch is closed.
+	err error
+}
+
+// A bufferedMessage is the result of reading a message in the background.
+type bufferedMessage struct {
+	msg *Message
+	err error
+}
+
+// stop interrupts the decoder, if it was started, and waits for it to exit.
+func (b *messageBuffer) stop() {
+	if b.cancel == nil {
+		return
+	}
+	b.cancel()
+	<-b.done
+}
+
+// Buffered returns the number of messages decoded in the background and waiting to be read. It is always zero unless
+// WithBuffer was used.
+func (c *Stream) Buffered() int {
+	return len(c.buffer.ch)
+}
+
+// nextBuffered returns the next message from the background decoder, starting it if necessary.
+func (c *Stream) nextBuffered(ctx context.Context) (*Message, error) {
+	b := &c.buffer
+	b.once.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		b.cancel = cancel
+		b.done = make(chan struct{})
+		go c.decode(ctx)
+	})
+	if b.cancel == nil {
+		// The Stream was closed before it was first read.
+		return nil, ErrStreamClosed
+	}
+
+	select {
+	case r, ok := <-b.ch:
+		if !ok {
+			return nil, b.err
+		}
+		return c.deliver(r.msg, r.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// decode reads messages into the buffer until reading fails in a way the Stream cannot recover from, or ctx is
+// cancelled by Close.
+func (c *Stream) decode(ctx context.Context) {
+	b := &c.buffer
+	defer close(b.done)
+	defer close(b.ch)
+	for {
+		msg, err := c.next(ctx)
+		if ctx.Err() != nil {
+			b.err = ErrStreamClosed
+			return
+		}
+		// Errors which come with a message, such as one which could not be decoded, and errors after which the Stream
+		// can continue to be read, are delivered in order with the messages. Any other error ends the stream.
+		if err != nil && msg == nil && !errors.Is(err, ErrMessageTooLarge) && !errors.Is(err, ErrReadTimeout) {
+			b.err = err
+			return
+		}
+		select {
+		case b.ch <- bufferedMessage{msg, err}:
+		case <-ctx.Done():
+			b.err = ErrStreamClosed
+			return
+		}
+	}
+}
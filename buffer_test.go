@@ -0,0 +1,110 @@
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestBuffer(t *testing.T) {
+	stream, server := pipeStream(t, firehose.WithBuffer(2))
+	lines := make([]string, 5)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`{"type":"position","ident":"A%d","pitr":"%d"}`, i, 1000+i)
+	}
+	serve(server, lines...)
+
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Payload.(firehose.PositionMessage).Ident != "A0" {
+		t.Errorf("unexpected first message: %#v", msg.Payload)
+	}
+
+	// The decoder fills the buffer and then waits for the consumer.
+	deadline := time.Now().Add(5 * time.Second)
+	for stream.Buffered() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := stream.Buffered(); n != 2 {
+		t.Fatalf("expected a full buffer of 2 messages, got %d", n)
+	}
+	if stream.PITR() != "1000" {
+		t.Errorf("PITR should only advance as messages are returned, got: %s", stream.PITR())
+	}
+
+	for i := 1; i < len(lines); i++ {
+		msg, err := stream.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ident := msg.Payload.(firehose.PositionMessage).Ident; ident != fmt.Sprintf("A%d", i) {
+			t.Errorf("expected message A%d, got %s", i, ident)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := stream.NextMessage(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded while waiting, got: %v", err)
+	}
+
+	if err := stream.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+	if _, err := stream.NextMessage(context.Background()); !errors.Is(err, firehose.ErrStreamClosed) {
+		t.Errorf("expected ErrStreamClosed after Close, got: %v", err)
+	}
+}
+
+func TestBufferEndOfInput(t *testing.T) {
+	data := `{"type":"keepalive","serverTime":"1"}
+not json
+{"type":"keepalive","serverTime":"2"}
+`
+	stream := firehose.NewReader(strings.NewReader(data), firehose.WithBuffer(4))
+	if _, err := stream.NextMessage(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := stream.NextMessage(context.Background()); err == nil {
+		t.Errorf("expected decoding error")
+	}
+	if _, err := stream.NextMessage(context.Background()); err != nil {
+		t.Fatalf("expected the stream to continue after a decoding error, got: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := stream.NextMessage(context.Background()); !errors.Is(err, io.EOF) {
+			t.Errorf("expected EOF, got: %v", err)
+		}
+	}
+}
+
+func TestBufferedDuringFirstRead(t *testing.T) {
+	// Buffered may be called from any goroutine, including while the first read starts the decoder. The race detector
+	// checks that this is safe.
+	stream := firehose.NewReader(strings.NewReader(`{"type":"keepalive","serverTime":"1"}`+"\n"), firehose.WithBuffer(4))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if n := stream.Buffered(); n < 0 || n > 4 {
+				t.Errorf("unexpected buffered count: %d", n)
+			}
+		}
+	}()
+	if _, err := stream.NextMessage(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-done
+	if err := stream.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package firehose
+
+import (
+	"container/list"
+	"time"
+)
+
+// DefaultClockCheckFlights is the number of flights whose latest clock is remembered by WithClockCheck when it is not
+// given a positive limit.
+const DefaultClockCheckFlights = 10000
+
+// clockCheck remembers the latest Clock seen for each of the most recently active flights, evicting the least recently
+// seen flight once the limit is reached.
+type clockCheck struct {
+	limit  int
+	report func(id string, clock, latest time.Time)
+	// order holds a *clockEntry for each flight, most recently seen first.
+	order   *list.List
+	flights map[string]*list.Element
+}
+
+type clockEntry struct {
+	id     string
+	latest time.Time
+}
+
+func newClockCheck(limit int, report func(id string, clock, latest time.Time)) *clockCheck {
+	return &clockCheck{
+		limit:   limit,
+		report:  report,
+		order:   list.New(),
+		flights: make(map[string]*list.Element),
+	}
+}
+
+// observe records the position's clock, reporting whether it precedes the latest clock already seen for the flight.
+// Positions without an id or a valid clock are ignored.
+func (c *clockCheck) observe(pos PositionMessage) bool {
+	if pos.ID == "" {
+		return false
+	}
+	clock, err := parseEpoch(pos.Clock)
+	if err != nil {
+		return false
+	}
+
+	if elem, ok := c.flights[pos.ID]; ok {
+		c.order.MoveToFront(elem)
+		entry := elem.Value.(*clockEntry)
+		if clock.Before(entry.latest) {
+			if c.report != nil {
+				c.report(pos.ID, clock, entry.latest)
+			}
+			return true
+		}
+		entry.latest = clock
+		return false
+	}
+
+	c.flights[pos.ID] = c.order.PushFront(&clockEntry{id: pos.ID, latest: clock})
+	if c.order.Len() > c.limit {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.flights, oldest.Value.(*clockEntry).id)
+	}
+	return false
+}
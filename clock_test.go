@@ -0,0 +1,67 @@
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestClockCheck(t *testing.T) {
+	data := `{"type":"position","id":"F1","clock":"100"}
+{"type":"position","id":"F1","clock":"200"}
+{"type":"position","id":"F2","clock":"50"}
+{"type":"position","id":"F1","clock":"150"}
+{"type":"position","id":"F1","clock":"200"}
+`
+	type regression struct {
+		id            string
+		clock, latest int64
+	}
+	var got []regression
+	stream := firehose.NewReader(strings.NewReader(data), firehose.WithClockCheck(0, func(id string, clock, latest time.Time) {
+		got = append(got, regression{id, clock.Unix(), latest.Unix()})
+	}))
+	n := 0
+	for {
+		_, err := stream.NextMessage(context.Background())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("expected regressed messages to be returned, got %d messages", n)
+	}
+	if len(got) != 1 || got[0] != (regression{"F1", 150, 200}) {
+		t.Errorf("unexpected regressions: %v", got)
+	}
+	if stats := stream.Stats(); stats.ClockRegressions != 1 {
+		t.Errorf("expected 1 clock regression, got %d", stats.ClockRegressions)
+	}
+}
+
+func TestClockCheckEviction(t *testing.T) {
+	data := `{"type":"position","id":"F1","clock":"200"}
+{"type":"position","id":"F2","clock":"200"}
+{"type":"position","id":"F1","clock":"100"}
+{"type":"position","id":"F2","clock":"100"}
+`
+	stream := firehose.NewReader(strings.NewReader(data), firehose.WithClockCheck(1, nil))
+	for {
+		if _, err := stream.NextMessage(context.Background()); err != nil {
+			break
+		}
+	}
+	// F1 is forgotten when F2 is seen, and F2 when F1 is seen again, so neither regression is remembered.
+	if stats := stream.Stats(); stats.ClockRegressions != 0 {
+		t.Errorf("expected evicted flights not to be checked, got %d regressions", stats.ClockRegressions)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/benburwell/firehose"
+)
+
+// csvColumns are the position fields written by the csv format, in order.
+var csvColumns = []string{"id", "ident", "clock", "lat", "lon", "alt", "gs", "heading"}
+
+// A printer writes each message received to its output in one of the supported formats.
+type printer interface {
+	print(msg *firehose.Message) error
+}
+
+// newPrinter returns a printer for the named format, which is one of go, json, or csv.
+func newPrinter(format string, w io.Writer) (printer, error) {
+	switch format {
+	case "go":
+		return goPrinter{w}, nil
+	case "json":
+		return jsonPrinter{json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvPrinter{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q: must be one of go, json, or csv", format)
+	}
+}
+
+// goPrinter writes each message payload in Go syntax.
+type goPrinter struct {
+	w io.Writer
+}
+
+func (p goPrinter) print(msg *firehose.Message) error {
+	_, err := fmt.Fprintf(p.w, "%#v\n", msg.Payload)
+	return err
+}
+
+// jsonPrinter writes each message as a line of JSON, in the form in which it was received.
+type jsonPrinter struct {
+	enc *json.Encoder
+}
+
+func (p jsonPrinter) print(msg *firehose.Message) error {
+	return p.enc.Encode(msg)
+}
+
+// csvPrinter writes a row of csvColumns for each position message, after a header row. Other messages are skipped.
+type csvPrinter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (p *csvPrinter) print(msg *firehose.Message) error {
+	m, ok := msg.Payload.(firehose.PositionMessage)
+	if !ok {
+		return nil
+	}
+	if !p.header {
+		if err := p.w.Write(csvColumns); err != nil {
+			return err
+		}
+		p.header = true
+	}
+	// Fields missing from the message are empty strings, and so are written as empty columns.
+	if err := p.w.Write([]string{m.ID, m.Ident, m.Clock, m.Lat, m.Lon, m.Alt, m.GS, m.Heading}); err != nil {
+		return err
+	}
+	p.w.Flush()
+	return p.w.Error()
+}
@@ -0,0 +1,99 @@
+// Command stream_positions connects to Firehose and prints the messages it receives, which are positions unless other
+// events are selected with -event.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+// eventList is a flag.Value collecting the events given with each use of the -event flag.
+type eventList []firehose.Event
+
+func (l *eventList) String() string {
+	names := make([]string, len(*l))
+	for i, e := range *l {
+		names[i] = string(e)
+	}
+	return strings.Join(names, ",")
+}
+
+// Set parses a single event, or a comma-separated list of events.
+func (l *eventList) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		e, err := firehose.ParseEvent(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		*l = append(*l, e)
+	}
+	return nil
+}
+
+func main() {
+	var events eventList
+	flag.Var(&events, "event", "event type to request, such as position or departure; may be repeated or comma-separated (default position)")
+	username := flag.String("username", "", "Firehose account username (default $FIREHOSE_USERNAME)")
+	password := flag.String("password", "", "Firehose API key (default $FIREHOSE_PASSWORD)")
+	pitr := flag.String("pitr", "", "replay from this PITR instead of streaming live data")
+	airports := flag.String("airports", "", "space-separated list of airport glob patterns to filter on")
+	connectTimeout := flag.Duration("connect-timeout", 30*time.Second, "give up if the connection cannot be established within this time")
+	format := flag.String("format", "go", "output format: go (Go syntax), json (one JSON object per line), or csv (position columns only)")
+	dryRun := flag.Bool("dry-run", false, "print the init command with the password redacted and exit without connecting")
+	flag.Parse()
+	if len(events) == 0 {
+		events = eventList{firehose.PositionEvent}
+	}
+	if *username == "" && *password == "" {
+		user, pass, ok := firehose.CredentialsFromEnv()
+		if !ok {
+			fmt.Fprintln(os.Stderr, "no credentials: pass -username and -password, or set FIREHOSE_USERNAME and FIREHOSE_PASSWORD")
+			os.Exit(2)
+		}
+		*username, *password = user, pass
+	}
+
+	cmd := firehose.InitCommand{
+		Live:     *pitr == "",
+		PITR:     *pitr,
+		Username: *username,
+		Password: *password,
+		Events:   events,
+	}
+	if *airports != "" {
+		cmd.AirportFilter = strings.Fields(*airports)
+	}
+	if err := cmd.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	out, err := newPrinter(*format, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *dryRun {
+		fmt.Println(cmd.Redacted())
+		return
+	}
+
+	msgs, errc := firehose.Subscribe(context.Background(), cmd, firehose.WithDialer(&net.Dialer{Timeout: *connectTimeout}))
+	for msg := range msgs {
+		if err := out.print(msg); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := <-errc; err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,39 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CollectRange opens a Stream with OpenStream for cmd, which must request a Range, and returns every message
+// received until the server reports that the range is complete.
+//
+// If limit is positive, at most limit messages are collected, and ErrCollectLimit is returned along with them if the
+// range holds more, guarding against a range too large to hold in memory. If ctx is done or the connection fails
+// before the range is complete, the messages collected so far are returned along with the error.
+func CollectRange(ctx context.Context, cmd InitCommand, limit int, opts ...Option) ([]*Message, error) {
+	if cmd.Range == nil {
+		return nil, fmt.Errorf("%w: CollectRange requires a range", ErrInvalidInitCommand)
+	}
+	stream, err := OpenStream(ctx, cmd, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var msgs []*Message
+	for {
+		msg, err := stream.NextMessage(ctx)
+		if errors.Is(err, ErrRangeComplete) {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, err
+		}
+		if limit > 0 && len(msgs) == limit {
+			return msgs, ErrCollectLimit
+		}
+		msgs = append(msgs, msg)
+	}
+}
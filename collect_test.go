@@ -0,0 +1,68 @@
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/benburwell/firehose"
+	"github.com/benburwell/firehose/firehosetest"
+)
+
+func TestCollectRange(t *testing.T) {
+	srv := firehosetest.NewServer(
+		`{"type":"position","ident":"A1","pitr":"1000"}`,
+		`{"type":"position","ident":"A2","pitr":"1001"}`,
+		`{"type":"position","ident":"A3","pitr":"1002"}`,
+	)
+	defer srv.Close()
+
+	cmd := firehose.InitCommand{
+		Range:    &firehose.PITRRange{Start: "1000", End: "1002"},
+		Username: "un",
+		Password: "pw",
+	}
+	msgs, err := firehose.CollectRange(context.Background(), cmd, 0, srv.Options()...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(msgs) != 3 || msgs[2].PITR != "1002" {
+		t.Errorf("unexpected messages: %v", msgs)
+	}
+
+	msgs, err = firehose.CollectRange(context.Background(), cmd, 2, srv.Options()...)
+	if !errors.Is(err, firehose.ErrCollectLimit) {
+		t.Errorf("expected ErrCollectLimit, got: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Errorf("expected the messages up to the limit, got %d", len(msgs))
+	}
+
+	cmd.Range, cmd.Live = nil, true
+	if _, err := firehose.CollectRange(context.Background(), cmd, 0, srv.Options()...); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand without a range, got: %v", err)
+	}
+}
+
+func TestCollectRangeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := firehosetest.NewServerFunc(func(c *firehosetest.Conn) {
+		c.Send(`{"type":"position","ident":"A1","pitr":"1000"}`)
+		cancel()
+		c.Read(make([]byte, 1))
+	})
+	defer srv.Close()
+
+	cmd := firehose.InitCommand{
+		Range:    &firehose.PITRRange{Start: "1000", End: "2000"},
+		Username: "un",
+		Password: "pw",
+	}
+	msgs, err := firehose.CollectRange(ctx, cmd, 0, srv.Options()...)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context's error, got: %v", err)
+	}
+	if len(msgs) > 1 {
+		t.Errorf("unexpected messages: %v", msgs)
+	}
+}
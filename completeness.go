@@ -0,0 +1,105 @@
+package firehose
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// structField identifies a struct field by its index and JSON key.
+type structField struct {
+	index int
+	name  string
+}
+
+// positionFields lists the fields of PositionMessage which are tracked by a CompletenessTracker.
+var positionFields = jsonFields(reflect.TypeOf(PositionMessage{}))
+
+// jsonFields enumerates the JSON-tagged fields of a struct type, excluding the message type discriminator.
+func jsonFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" || name == "type" {
+			continue
+		}
+		fields = append(fields, structField{index: i, name: name})
+	}
+	return fields
+}
+
+// A CompletenessTracker measures how often each field of PositionMessage is populated over a sliding window of the
+// most recently observed positions.
+//
+// This makes it possible to notice upstream data quality regressions, such as a sudden drop in the fraction of
+// positions reporting an altitude or squawk code. A field is considered present when it holds a non-zero value.
+//
+// A CompletenessTracker is safe for concurrent use.
+type CompletenessTracker struct {
+	mu      sync.Mutex
+	words   int
+	samples []uint64
+	size    int
+	next    int
+	window  int
+	counts  []int
+}
+
+// NewCompletenessTracker creates a CompletenessTracker which considers the most recent window positions.
+func NewCompletenessTracker(window int) *CompletenessTracker {
+	if window < 1 {
+		window = 1
+	}
+	words := (len(positionFields) + 63) / 64
+	return &CompletenessTracker{
+		words:   words,
+		samples: make([]uint64, window*words),
+		window:  window,
+		counts:  make([]int, len(positionFields)),
+	}
+}
+
+// Observe records which fields of p are populated, evicting the oldest position from the window if it is full.
+func (c *CompletenessTracker) Observe(p PositionMessage) {
+	v := reflect.ValueOf(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sample := c.samples[c.next*c.words : (c.next+1)*c.words]
+	if c.size == c.window {
+		for i := range positionFields {
+			if sample[i/64]&(1<<(i%64)) != 0 {
+				c.counts[i]--
+			}
+		}
+	} else {
+		c.size++
+	}
+	for i := range sample {
+		sample[i] = 0
+	}
+	for i, f := range positionFields {
+		if !v.Field(f.index).IsZero() {
+			sample[i/64] |= 1 << (i % 64)
+			c.counts[i]++
+		}
+	}
+	c.next = (c.next + 1) % c.window
+}
+
+// Snapshot returns the fraction, between 0 and 1, of positions in the current window which populated each field. The
+// map is keyed by the field's JSON name, for example "squawk". If no positions have been observed, the map is empty.
+func (c *CompletenessTracker) Snapshot() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rates := make(map[string]float64, len(positionFields))
+	if c.size == 0 {
+		return rates
+	}
+	for i, f := range positionFields {
+		rates[f.name] = float64(c.counts[i]) / float64(c.size)
+	}
+	return rates
+}
@@ -0,0 +1,43 @@
+package firehose_test
+
+import (
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestCompletenessTracker(t *testing.T) {
+	c := firehose.NewCompletenessTracker(4)
+	if len(c.Snapshot()) != 0 {
+		t.Errorf("expected empty snapshot before any observations")
+	}
+
+	c.Observe(firehose.PositionMessage{Alt: "100", Squawk: "1200"})
+	c.Observe(firehose.PositionMessage{Alt: "200"})
+	c.Observe(firehose.PositionMessage{Alt: "300"})
+	c.Observe(firehose.PositionMessage{})
+
+	snap := c.Snapshot()
+	if snap["alt"] != 0.75 {
+		t.Errorf("unexpected alt rate: %f", snap["alt"])
+	}
+	if snap["squawk"] != 0.25 {
+		t.Errorf("unexpected squawk rate: %f", snap["squawk"])
+	}
+	if _, ok := snap["type"]; ok {
+		t.Errorf("type should not be tracked")
+	}
+
+	// Pushing the first observation out of the window drops its squawk.
+	c.Observe(firehose.PositionMessage{Alt: "400", NACp: 8})
+	snap = c.Snapshot()
+	if snap["squawk"] != 0 {
+		t.Errorf("unexpected squawk rate after eviction: %f", snap["squawk"])
+	}
+	if snap["alt"] != 0.75 {
+		t.Errorf("unexpected alt rate after eviction: %f", snap["alt"])
+	}
+	if snap["nac_p"] != 0.25 {
+		t.Errorf("unexpected nac_p rate: %f", snap["nac_p"])
+	}
+}
@@ -0,0 +1,84 @@
+package firehose_test
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		compression firehose.Compression
+		writer      func(io.Writer) io.WriteCloser
+	}{
+		{firehose.CompressionGzip, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{firehose.CompressionCompress, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		{firehose.CompressionDeflate, func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.compression), func(t *testing.T) {
+			stream, server := pipeStream(t, firehose.WithCompression(tc.compression))
+			initc := make(chan string, 1)
+			go func() {
+				// The init command is sent uncompressed, and everything after it is compressed.
+				line, _ := bufio.NewReader(server).ReadString('\n')
+				initc <- line
+				w := tc.writer(server)
+				fmt.Fprintln(w, `{"type":"position","ident":"WSN145"}`)
+				fmt.Fprintln(w, `{"type":"position","ident":"WSN146"}`)
+				w.Close()
+			}()
+
+			cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw", Compression: tc.compression}
+			if err := stream.Init(cmd.String()); err != nil {
+				t.Fatalf("could not initialize stream: %v", err)
+			}
+			if line := <-initc; !strings.HasSuffix(line, " compression "+string(tc.compression)+"\n") {
+				t.Errorf("unexpected init command: %q", line)
+			}
+
+			for _, ident := range []string{"WSN145", "WSN146"} {
+				msg, err := stream.NextMessage(context.Background())
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if pos, ok := msg.Payload.(firehose.PositionMessage); !ok || pos.Ident != ident {
+					t.Errorf("unexpected message: %#v", msg.Payload)
+				}
+			}
+		})
+	}
+}
+
+func TestInitWithCompression(t *testing.T) {
+	stream, server := pipeStream(t)
+	go func() {
+		bufio.NewReader(server).ReadString('\n')
+		w := gzip.NewWriter(server)
+		fmt.Fprintln(w, `{"type":"position","ident":"WSN145"}`)
+		w.Close()
+	}()
+
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw", Compression: firehose.CompressionGzip}
+	if err := stream.InitWith(context.Background(), cmd); err != nil {
+		t.Fatalf("could not initialize stream: %v", err)
+	}
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pos, ok := msg.Payload.(firehose.PositionMessage); !ok || pos.Ident != "WSN145" {
+		t.Errorf("unexpected message: %#v", msg.Payload)
+	}
+}
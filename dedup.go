@@ -0,0 +1,110 @@
+package firehose
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// A Deduplicator drops repeated position reports, which are common when resuming from a PITR because the server
+// replays every message from the start of that second. Two positions are duplicates if they have the same ID and
+// Clock.
+//
+// Positions are remembered for a sliding window measured back from the latest Clock seen rather than from the wall
+// clock, so a Deduplicator behaves the same for replayed data as for a live stream, and memory is bounded by the
+// number of positions reported within the window. A position older than the window cannot be recognized as a
+// duplicate and is always kept.
+//
+// A Deduplicator is safe for concurrent use.
+type Deduplicator struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	seen   map[positionKey]struct{}
+	expiry positionHeap
+	latest time.Time
+}
+
+// positionKey identifies a position report.
+type positionKey struct {
+	id    string
+	clock string
+}
+
+// NewDeduplicator creates a Deduplicator which remembers positions for the given window.
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		window: window,
+		seen:   make(map[positionKey]struct{}),
+	}
+}
+
+// Duplicate reports whether msg is a position which has already been seen within the window, and remembers it if
+// not. Messages other than positions, and positions without an ID or a valid Clock, are never duplicates.
+func (d *Deduplicator) Duplicate(msg *Message) bool {
+	pos, ok := msg.Payload.(PositionMessage)
+	if !ok || pos.ID == "" {
+		return false
+	}
+	at, err := pos.Time()
+	if err != nil {
+		return false
+	}
+	key := positionKey{pos.ID, pos.Clock}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	if at.After(d.latest) {
+		d.latest = at
+	}
+	cutoff := d.latest.Add(-d.window)
+	if at.Before(cutoff) {
+		return false
+	}
+	d.seen[key] = struct{}{}
+	heap.Push(&d.expiry, seenPosition{key, at})
+	for len(d.expiry) > 0 && d.expiry[0].at.Before(cutoff) {
+		delete(d.seen, heap.Pop(&d.expiry).(seenPosition).key)
+	}
+	return false
+}
+
+// Filter passes on the messages received from ch, dropping duplicate positions. The returned channel is closed once ch
+// is closed.
+func (d *Deduplicator) Filter(ch <-chan *Message) <-chan *Message {
+	out := make(chan *Message)
+	go func() {
+		defer close(out)
+		for msg := range ch {
+			if d.Duplicate(msg) {
+				continue
+			}
+			out <- msg
+		}
+	}()
+	return out
+}
+
+// seenPosition is a remembered position along with its report time.
+type seenPosition struct {
+	key positionKey
+	at  time.Time
+}
+
+// positionHeap orders remembered positions by time, oldest first.
+type positionHeap []seenPosition
+
+func (h positionHeap) Len() int           { return len(h) }
+func (h positionHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h positionHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *positionHeap) Push(x any)        { *h = append(*h, x.(seenPosition)) }
+
+func (h *positionHeap) Pop() any {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
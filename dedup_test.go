@@ -0,0 +1,43 @@
+package firehose_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestDeduplicator(t *testing.T) {
+	d := firehose.NewDeduplicator(time.Minute)
+	in := make(chan *firehose.Message)
+	go func() {
+		defer close(in)
+		in <- position("F1", "1000", firehose.AirGroundAir)
+		in <- position("F1", "1000", firehose.AirGroundAir)
+		in <- position("F2", "1000", firehose.AirGroundAir)
+		in <- position("F1", "1001", firehose.AirGroundAir)
+		in <- &firehose.Message{Type: "keepalive", Payload: firehose.KeepaliveMessage{}}
+		in <- &firehose.Message{Type: "keepalive", Payload: firehose.KeepaliveMessage{}}
+		in <- position("F1", "1000", firehose.AirGroundAir)
+	}()
+
+	kept := 0
+	for range d.Filter(in) {
+		kept++
+	}
+	if kept != 5 {
+		t.Errorf("expected 5 messages to be kept, got %d", kept)
+	}
+}
+
+func TestDeduplicatorWindow(t *testing.T) {
+	d := firehose.NewDeduplicator(time.Minute)
+	d.Duplicate(position("F1", "1000", firehose.AirGroundAir))
+	d.Duplicate(position("F1", "1100", firehose.AirGroundAir))
+	if d.Duplicate(position("F1", "1000", firehose.AirGroundAir)) {
+		t.Errorf("position older than the window should not be remembered")
+	}
+	if !d.Duplicate(position("F1", "1100", firehose.AirGroundAir)) {
+		t.Errorf("expected position within the window to be a duplicate")
+	}
+}
@@ -0,0 +1,143 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+)
+
+// A Dispatcher reads messages from a Stream and calls the handler registered for each message's type, sparing
+// consumers a type switch over Message.Payload.
+//
+// Messages of a type without a registered handler are skipped. Handlers are called synchronously, one message at a
+// time, and should be registered before calling Run.
+type Dispatcher struct {
+	onPosition           func(PositionMessage)
+	onFlightPlan         func(FlightPlanMessage)
+	onDeparture          func(DepartureMessage)
+	onArrival            func(ArrivalMessage)
+	onCancellation       func(CancellationMessage)
+	onGroundPosition     func(GroundPositionMessage)
+	onFmsWx              func(FmsWxMessage)
+	onExtendedFlightInfo func(ExtendedFlightInfoMessage)
+	onVehiclePosition    func(VehiclePositionMessage)
+	onPowerOn            func(PowerOnMessage)
+	onSurfaceOffblock    func(SurfaceOffblockMessage)
+	onSurfaceOnblock     func(SurfaceOnblockMessage)
+	onKeepalive          func(KeepaliveMessage)
+	onError              func(ErrorMessage)
+	onUnknown            func(UnknownMessage)
+}
+
+// NewDispatcher creates a Dispatcher without any handlers.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// OnPosition registers the handler for position messages.
+func (d *Dispatcher) OnPosition(fn func(PositionMessage)) { d.onPosition = fn }
+
+// OnFlightPlan registers the handler for flight plan messages.
+func (d *Dispatcher) OnFlightPlan(fn func(FlightPlanMessage)) { d.onFlightPlan = fn }
+
+// OnDeparture registers the handler for departure messages.
+func (d *Dispatcher) OnDeparture(fn func(DepartureMessage)) { d.onDeparture = fn }
+
+// OnArrival registers the handler for arrival messages.
+func (d *Dispatcher) OnArrival(fn func(ArrivalMessage)) { d.onArrival = fn }
+
+// OnCancellation registers the handler for cancellation messages.
+func (d *Dispatcher) OnCancellation(fn func(CancellationMessage)) { d.onCancellation = fn }
+
+// OnGroundPosition registers the handler for ground position messages.
+func (d *Dispatcher) OnGroundPosition(fn func(GroundPositionMessage)) { d.onGroundPosition = fn }
+
+// OnFmsWx registers the handler for fmswx messages.
+func (d *Dispatcher) OnFmsWx(fn func(FmsWxMessage)) { d.onFmsWx = fn }
+
+// OnExtendedFlightInfo registers the handler for extended flight info messages.
+func (d *Dispatcher) OnExtendedFlightInfo(fn func(ExtendedFlightInfoMessage)) {
+	d.onExtendedFlightInfo = fn
+}
+
+// OnVehiclePosition registers the handler for vehicle position messages.
+func (d *Dispatcher) OnVehiclePosition(fn func(VehiclePositionMessage)) { d.onVehiclePosition = fn }
+
+// OnPowerOn registers the handler for power on messages.
+func (d *Dispatcher) OnPowerOn(fn func(PowerOnMessage)) { d.onPowerOn = fn }
+
+// OnSurfaceOffblock registers the handler for surface offblock messages.
+func (d *Dispatcher) OnSurfaceOffblock(fn func(SurfaceOffblockMessage)) { d.onSurfaceOffblock = fn }
+
+// OnSurfaceOnblock registers the handler for surface onblock messages.
+func (d *Dispatcher) OnSurfaceOnblock(fn func(SurfaceOnblockMessage)) { d.onSurfaceOnblock = fn }
+
+// OnKeepalive registers the handler for keepalive messages.
+func (d *Dispatcher) OnKeepalive(fn func(KeepaliveMessage)) { d.onKeepalive = fn }
+
+// OnError registers the handler for error messages sent by the server.
+func (d *Dispatcher) OnError(fn func(ErrorMessage)) { d.onError = fn }
+
+// OnUnknown registers the handler for messages of types which this package cannot decode.
+func (d *Dispatcher) OnUnknown(fn func(UnknownMessage)) { d.onUnknown = fn }
+
+// Dispatch calls the handler registered for msg's type, if any.
+func (d *Dispatcher) Dispatch(msg *Message) {
+	switch m := msg.Payload.(type) {
+	case PositionMessage:
+		call(d.onPosition, m)
+	case FlightPlanMessage:
+		call(d.onFlightPlan, m)
+	case DepartureMessage:
+		call(d.onDeparture, m)
+	case ArrivalMessage:
+		call(d.onArrival, m)
+	case CancellationMessage:
+		call(d.onCancellation, m)
+	case GroundPositionMessage:
+		call(d.onGroundPosition, m)
+	case FmsWxMessage:
+		call(d.onFmsWx, m)
+	case ExtendedFlightInfoMessage:
+		call(d.onExtendedFlightInfo, m)
+	case VehiclePositionMessage:
+		call(d.onVehiclePosition, m)
+	case PowerOnMessage:
+		call(d.onPowerOn, m)
+	case SurfaceOffblockMessage:
+		call(d.onSurfaceOffblock, m)
+	case SurfaceOnblockMessage:
+		call(d.onSurfaceOnblock, m)
+	case KeepaliveMessage:
+		call(d.onKeepalive, m)
+	case ErrorMessage:
+		call(d.onError, m)
+	case UnknownMessage:
+		call(d.onUnknown, m)
+	}
+}
+
+// Run dispatches every message read from stream until ctx is done or reading fails, and returns the error which
+// stopped it. Oversized messages are skipped. An error message from the server is dispatched to the OnError handler
+// before Run returns the corresponding error.
+func (d *Dispatcher) Run(ctx context.Context, stream *Stream) error {
+	for {
+		msg, err := stream.NextMessage(ctx)
+		if errors.Is(err, ErrMessageTooLarge) {
+			continue
+		}
+		var em *ErrorMessage
+		if errors.As(err, &em) {
+			d.Dispatch(msg)
+		}
+		if err != nil {
+			return err
+		}
+		d.Dispatch(msg)
+	}
+}
+
+func call[T any](fn func(T), m T) {
+	if fn != nil {
+		fn(m)
+	}
+}
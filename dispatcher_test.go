@@ -0,0 +1,49 @@
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestDispatcher(t *testing.T) {
+	stream := firehose.NewReader(strings.NewReader(`{"type":"position","ident":"A"}
+{"type":"keepalive","serverTime":"1"}
+{"type":"arrival","ident":"B"}
+{"type":"somethingnew"}
+{"type":"position","ident":"C"}
+`))
+
+	var seen []string
+	d := firehose.NewDispatcher()
+	d.OnPosition(func(p firehose.PositionMessage) { seen = append(seen, "position "+p.Ident) })
+	d.OnArrival(func(a firehose.ArrivalMessage) { seen = append(seen, "arrival "+a.Ident) })
+	d.OnUnknown(func(u firehose.UnknownMessage) { seen = append(seen, "unknown "+u.Type) })
+
+	if err := d.Run(context.Background(), stream); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+	expected := "position A,arrival B,unknown somethingnew,position C"
+	if actual := strings.Join(seen, ","); actual != expected {
+		t.Errorf("unexpected dispatch order: %s", actual)
+	}
+}
+
+func TestDispatcherError(t *testing.T) {
+	stream := firehose.NewReader(strings.NewReader(`{"type":"error","error_msg":"Invalid username or password"}
+`))
+	var handled string
+	d := firehose.NewDispatcher()
+	d.OnError(func(e firehose.ErrorMessage) { handled = e.ErrorMessage })
+
+	if err := d.Run(context.Background(), stream); !errors.Is(err, firehose.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got: %v", err)
+	}
+	if handled != "Invalid username or password" {
+		t.Errorf("error message was not dispatched: %q", handled)
+	}
+}
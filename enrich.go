@@ -0,0 +1,19 @@
+package firehose
+
+// An Enricher attaches additional information to position messages as they are read from a Stream, for example
+// operator or ownership details looked up from a registry by Hexid or Reg.
+//
+// Enrich runs synchronously on the read path for every position, so it should be fast; slow lookups delay delivery of
+// all subsequent messages. An Enricher may modify any field of the position, and may store arbitrary data in its
+// Enrichment field. If Enrich returns an error, Stream.NextMessage returns the message along with the error.
+type Enricher interface {
+	Enrich(*PositionMessage) error
+}
+
+// EnricherFunc adapts an ordinary function into an Enricher.
+type EnricherFunc func(*PositionMessage) error
+
+// Enrich calls f(p).
+func (f EnricherFunc) Enrich(p *PositionMessage) error {
+	return f(p)
+}
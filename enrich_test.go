@@ -0,0 +1,74 @@
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+// Operator describes who operates an aircraft.
+type Operator struct {
+	Name    string
+	Country string
+}
+
+func ExampleEnricherFunc() {
+	registry := map[string]Operator{
+		"A15815": {Name: "Wings of the Isthmus", Country: "PA"},
+	}
+	enricher := firehose.EnricherFunc(func(p *firehose.PositionMessage) error {
+		if op, ok := registry[p.Hexid]; ok {
+			p.Enrichment = op
+		}
+		return nil
+	})
+
+	// Normally the enricher would be passed to Dial or NewStream with firehose.WithEnricher(enricher), in which case
+	// it is applied to every position read from the stream.
+	pos := firehose.PositionMessage{Ident: "WSN145", Hexid: "A15815"}
+	if err := enricher.Enrich(&pos); err != nil {
+		panic(err)
+	}
+	op := pos.Enrichment.(Operator)
+	fmt.Printf("%s is operated by %s (%s)\n", pos.Ident, op.Name, op.Country)
+	// Output: WSN145 is operated by Wings of the Isthmus (PA)
+}
+
+func TestWithEnricher(t *testing.T) {
+	enricher := firehose.EnricherFunc(func(p *firehose.PositionMessage) error {
+		if p.Reg == "" {
+			return errors.New("no registration")
+		}
+		p.Enrichment = "owner of " + p.Reg
+		return nil
+	})
+	stream, server := pipeStream(t, firehose.WithEnricher(enricher))
+	serve(server,
+		`{"type":"position","ident":"WSN145","reg":"N186MM"}`,
+		`{"type":"position","ident":"WSN146"}`,
+		`{"type":"keepalive","serverTime":"1596067800"}`,
+	)
+
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pos := msg.Payload.(firehose.PositionMessage); pos.Enrichment != "owner of N186MM" {
+		t.Errorf("unexpected enrichment: %#v", pos.Enrichment)
+	}
+
+	msg, err = stream.NextMessage(context.Background())
+	if err == nil {
+		t.Errorf("expected enrichment error")
+	}
+	if pos := msg.Payload.(firehose.PositionMessage); pos.Ident != "WSN146" {
+		t.Errorf("expected message alongside enrichment error, got: %#v", pos)
+	}
+
+	if _, err := stream.NextMessage(context.Background()); err != nil {
+		t.Errorf("non-position messages should not be enriched: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidInitCommand is wrapped by errors describing why an InitCommand cannot be sent.
+var ErrInvalidInitCommand = errors.New("invalid init command")
+
+// ErrNotConnected is returned when attempting to send to the server on a Stream created with NewReader.
+var ErrNotConnected = errors.New("stream is not connected to a server")
+
+// ErrConcurrentRead is returned by Stream.NextMessage when it is called while another call is still in progress,
+// since a Stream can only have a single reader.
+var ErrConcurrentRead = errors.New("concurrent read from stream")
+
+// ErrStreamClosed is returned by Stream.NextMessage once the Stream has been closed, including by a call which was in
+// progress when Close was called.
+var ErrStreamClosed = errors.New("stream closed")
+
+// ErrCollectLimit is returned by CollectRange when the range holds more messages than the limit it was given. The
+// messages collected up to the limit are returned with it.
+var ErrCollectLimit = errors.New("range exceeds message limit")
+
+// ErrInitTimeout is returned by Stream.InitWith when WithInitTimeout was used and the server sent nothing in response
+// to the init command within the timeout.
+var ErrInitTimeout = errors.New("no response to init command")
+
+// ErrMessageTooLarge is returned by Stream.NextMessage when a message exceeds the maximum message size. The oversized
+// message is discarded and the stream can continue to be read.
+var ErrMessageTooLarge = errors.New("message exceeds maximum size")
+
+// ErrReadTimeout is wrapped by the error returned by Stream.NextMessage when no message arrives within the timeout
+// set with WithReadTimeout. The Stream can continue to be read.
+var ErrReadTimeout = errors.New("read timed out")
+
+// ErrStale is wrapped by the error returned by Stream.CheckLiveness when no message has been read within the interval
+// checked, which suggests that the connection is dead.
+var ErrStale = errors.New("stream is stale")
+
+// ErrWriteTimeout is wrapped by the error returned by Stream.Init and Stream.InitWith when the init command cannot be
+// sent within the timeout set with WithWriteTimeout. The connection should be closed and a new one made.
+var ErrWriteTimeout = errors.New("write timed out")
+
+// ErrKeepaliveTimeout is wrapped by the error returned by Stream.NextMessage when no message at all has arrived within
+// the timeout set with WithKeepaliveTimeout, which indicates that the connection is dead even though it has not been
+// closed. The Stream should be closed and a new connection made.
+var ErrKeepaliveTimeout = errors.New("keepalive timed out")
+
+// ErrRangeComplete is returned by Stream.NextMessage when the server closes the connection after the init command
+// requested a Range. The server closes the connection once every message in the range has been sent, and sends no
+// marker message beforehand, so the end of a ranged stream is recognized by the connection closing cleanly between
+// messages.
+var ErrRangeComplete = errors.New("range complete")
+
+// ErrCertificateNotPinned is returned by Dial when the server presents a certificate chain which does not include any
+// of the certificates pinned with WithPinnedCertificate.
+var ErrCertificateNotPinned = errors.New("server certificate does not match any pinned certificate")
+
+// ErrConnectionSuperseded is returned by Stream.NextMessage when the server ends the connection because another
+// connection was opened using the same credentials.
+//
+// Firehose only permits a limited number of concurrent connections per account, so this almost always means that a
+// second copy of the consumer is running somewhere, rather than that the network is misbehaving. Reconnecting
+// automatically in this situation causes the two instances to repeatedly disconnect each other. Deployments should
+// ensure that only a single instance consumes the feed for a given set of credentials, for example by running it as a
+// singleton or behind a leader election, and treat this error as fatal.
+var ErrConnectionSuperseded = errors.New("connection superseded by another connection using the same credentials")
+
+// ErrAuthFailed is wrapped by the error returned by Stream.NextMessage when the server rejects the credentials
+// supplied in the init command. Retrying with the same credentials will not succeed.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// ErrConnectionLimit is wrapped by the error returned by Stream.NextMessage when the server refuses the connection
+// because the account has too many concurrent connections or has exceeded a rate limit. Retrying after a delay may
+// succeed.
+var ErrConnectionLimit = errors.New("connection limit exceeded")
+
+// ErrInvalidFilter is wrapped by the error returned by Stream.NextMessage when the server rejects one of the filters
+// or other arguments in the init command.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// serverErrorPatterns map fragments of server error messages to the sentinel errors they indicate. The first entry
+// with a matching pattern wins.
+//
+// FlightAware does not document the exact wording of its error messages, so these are matched case-insensitively.
+var serverErrorPatterns = []struct {
+	err      error
+	patterns []string
+}{
+	{ErrConnectionSuperseded, []string{"superseded", "another connection", "duplicate connection", "newer connection"}},
+	{ErrAuthFailed, []string{"username", "password", "authenticat", "not authorized", "unauthorized", "login"}},
+	{ErrConnectionLimit, []string{"too many connections", "connection limit", "maximum number of connections", "rate limit"}},
+	{ErrInvalidFilter, []string{"filter", "invalid argument", "unrecognized", "unknown command", "syntax"}},
+}
+
+// classifyServerError returns the sentinel error indicated by a server error message, or nil if the message is not
+// recognized.
+func classifyServerError(msg string) error {
+	msg = strings.ToLower(msg)
+	for _, entry := range serverErrorPatterns {
+		for _, pattern := range entry.patterns {
+			if strings.Contains(msg, pattern) {
+				return entry.err
+			}
+		}
+	}
+	return nil
+}
+
+// IsRetryable reports whether the operation which failed with err may succeed if retried on a new connection, for use
+// by consumers which implement their own reconnection instead of using ResilientStream, which makes the same decision.
+//
+// Errors which retrying cannot resolve are not retryable: an invalid init command, a server error wrapping
+// ErrAuthFailed, ErrInvalidFilter, or ErrConnectionSuperseded, a cancelled or expired context, and ErrRangeComplete,
+// which indicates success. Other errors, including network errors, io.EOF, timeouts, and ErrConnectionLimit, are taken
+// to be transient. IsRetryable returns false for a nil error.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, ErrAuthFailed),
+		errors.Is(err, ErrInvalidFilter),
+		errors.Is(err, ErrConnectionSuperseded),
+		errors.Is(err, ErrInvalidInitCommand),
+		errors.Is(err, ErrNotConnected),
+		errors.Is(err, ErrRangeComplete),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	default:
+		return true
+	}
+}
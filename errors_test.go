@@ -0,0 +1,107 @@
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestConnectionSuperseded(t *testing.T) {
+	stream, server := pipeStream(t)
+	serve(server, `{"type":"error","error_msg":"Connection superseded by another connection"}`)
+
+	msg, err := stream.NextMessage(context.Background())
+	if !errors.Is(err, firehose.ErrConnectionSuperseded) {
+		t.Fatalf("expected ErrConnectionSuperseded, got: %v", err)
+	}
+	if _, ok := msg.Payload.(firehose.ErrorMessage); !ok {
+		t.Errorf("expected error message payload, got: %#v", msg.Payload)
+	}
+}
+
+func TestOtherErrorNotSuperseded(t *testing.T) {
+	stream, server := pipeStream(t)
+	serve(server, `{"type":"error","error_msg":"Invalid username or password"}`)
+
+	if _, err := stream.NextMessage(context.Background()); errors.Is(err, firehose.ErrConnectionSuperseded) {
+		t.Errorf("unexpected ErrConnectionSuperseded: %v", err)
+	}
+}
+
+func TestErrorMessageReturned(t *testing.T) {
+	stream, server := pipeStream(t)
+	serve(server, `{"type":"error","error_msg":"Invalid username or password"}`)
+
+	msg, err := stream.NextMessage(context.Background())
+	var em *firehose.ErrorMessage
+	if !errors.As(err, &em) {
+		t.Fatalf("expected *ErrorMessage, got: %v", err)
+	}
+	if em.ErrorMessage != "Invalid username or password" {
+		t.Errorf("unexpected error message: %q", em.ErrorMessage)
+	}
+	if payload, ok := msg.Payload.(firehose.ErrorMessage); !ok || payload != *em {
+		t.Errorf("unexpected payload: %#v", msg.Payload)
+	}
+}
+
+func TestServerErrorClassification(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want error
+	}{
+		{"Connection superseded by another connection", firehose.ErrConnectionSuperseded},
+		{"Invalid username or password", firehose.ErrAuthFailed},
+		{"Too many connections for this account", firehose.ErrConnectionLimit},
+		{"Invalid airport_filter value", firehose.ErrInvalidFilter},
+		{"Something unexpected happened", nil},
+	}
+	sentinels := []error{
+		firehose.ErrConnectionSuperseded,
+		firehose.ErrAuthFailed,
+		firehose.ErrConnectionLimit,
+		firehose.ErrInvalidFilter,
+	}
+	for _, test := range tests {
+		err := error(&firehose.ErrorMessage{Type: "error", ErrorMessage: test.msg})
+		for _, sentinel := range sentinels {
+			if got := errors.Is(err, sentinel); got != (sentinel == test.want) {
+				t.Errorf("errors.Is(%q, %v) = %t", test.msg, sentinel, got)
+			}
+		}
+		if !strings.Contains(err.Error(), test.msg) {
+			t.Errorf("error %q does not contain server message %q", err, test.msg)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	for _, err := range []error{
+		io.EOF,
+		&net.OpError{Op: "read", Err: errors.New("connection reset by peer")},
+		fmt.Errorf("%w: no message received for 1m0s", firehose.ErrKeepaliveTimeout),
+		firehose.ErrReadTimeout,
+		&firehose.ErrorMessage{ErrorMessage: "Too many connections"},
+	} {
+		if !firehose.IsRetryable(err) {
+			t.Errorf("expected %v to be retryable", err)
+		}
+	}
+	for _, err := range []error{
+		nil,
+		&firehose.ErrorMessage{ErrorMessage: "Invalid username or password"},
+		fmt.Errorf("%w: username is required", firehose.ErrInvalidInitCommand),
+		firehose.ErrRangeComplete,
+		context.Canceled,
+	} {
+		if firehose.IsRetryable(err) {
+			t.Errorf("expected %v not to be retryable", err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package firehose
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// numericPositionFields are the fields of PositionMessage which are transmitted as strings but always hold numbers.
+// Alt is left out, since aircraft on the ground may report a non-numeric altitude; see PositionMessage.Altitude.
+var numericPositionFields = selectFields(positionFields,
+	"lat", "lon", "clock", "pitr", "gs", "heading", "eta", "edt", "ete", "speed", "heading_magnetic",
+	"heading_true", "mach", "speed_tas", "speed_ias", "pressure", "wind_quality", "wind_dir", "wind_speed",
+	"temperature_quality", "temperature", "nav_heading", "nav_altitude", "nav_qnh", "alt_gnss", "vertRate",
+	"vertRate_geom", "fuel_on_board",
+)
+
+// selectFields returns the fields with the given JSON names.
+func selectFields(fields []structField, names ...string) []structField {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []structField
+	for _, f := range fields {
+		if wanted[f.name] {
+			selected = append(selected, f)
+		}
+	}
+	return selected
+}
+
+// validatePosition calls report for each numeric field of p which is populated but does not parse as a number.
+func validatePosition(p PositionMessage, report func(field, value string)) {
+	v := reflect.ValueOf(p)
+	for _, f := range numericPositionFields {
+		value := v.Field(f.index).String()
+		if value == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			report(f.name, value)
+		}
+	}
+}
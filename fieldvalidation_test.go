@@ -0,0 +1,46 @@
+package firehose_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestFieldValidation(t *testing.T) {
+	anomalies := make(map[string]string)
+	stream, server := pipeStream(t, firehose.WithFieldValidation(func(field, value string) {
+		anomalies[field] = value
+	}))
+	serve(server, `{"type":"position","ident":"WSN145","lat":"9.01767","lon":"-79.42058","gs":"fast","alt":"1550"}`)
+
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("validation anomalies should not fail the stream: %v", err)
+	}
+	if pos := msg.Payload.(firehose.PositionMessage); pos.GS != "fast" {
+		t.Errorf("unexpected ground speed: %s", pos.GS)
+	}
+	if len(anomalies) != 1 || anomalies["gs"] != "fast" {
+		t.Errorf("unexpected anomalies: %v", anomalies)
+	}
+}
+
+func TestFieldValidationGroundAltitude(t *testing.T) {
+	var anomalies []string
+	stream, server := pipeStream(t, firehose.WithFieldValidation(func(field, value string) {
+		anomalies = append(anomalies, field+"="+value)
+	}))
+	serve(server, `{"type":"position","ident":"WSN145","lat":"9.01767","lon":"-79.42058","gs":"0","alt":"G","air_ground":"G"}`)
+
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := msg.Payload.(firehose.PositionMessage).Altitude(); ok {
+		t.Errorf("expected a non-numeric altitude")
+	}
+	if len(anomalies) != 0 {
+		t.Errorf("a non-numeric altitude on the ground should not be reported, got: %v", anomalies)
+	}
+}
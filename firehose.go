@@ -1,12 +1,24 @@
 package firehose
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // DefaultAddress is the default server address to use for Firehose connections.
@@ -18,6 +30,69 @@ type Event string
 const (
 	// PositionEvent indicates a position report from the airborne feed.
 	PositionEvent Event = "position"
+	// FlightPlanEvent indicates a new or updated flight plan.
+	FlightPlanEvent Event = "flightplan"
+	// DepartureEvent indicates that a flight has departed.
+	DepartureEvent Event = "departure"
+	// ArrivalEvent indicates that a flight has arrived.
+	ArrivalEvent Event = "arrival"
+	// CancellationEvent indicates that a flight has been cancelled.
+	CancellationEvent Event = "cancellation"
+	// GroundPositionEvent indicates a position report from an airport surface.
+	GroundPositionEvent Event = "ground_position"
+	// FmsWxEvent indicates weather reported by an aircraft's flight management system.
+	FmsWxEvent Event = "fmswx"
+	// PowerOnEvent indicates that an aircraft's transponder has been powered on.
+	PowerOnEvent Event = "power_on"
+	// ExtendedFlightInfoEvent indicates schedule, gate, and codeshare details for a flight.
+	ExtendedFlightInfoEvent Event = "extendedFlightInfo"
+	// VehiclePositionEvent indicates a position report from an airport ground vehicle.
+	VehiclePositionEvent Event = "vehicleposition"
+	// SurfaceOffblockEvent indicates that a flight has pushed back or left its gate.
+	SurfaceOffblockEvent Event = "surface_offblock"
+	// SurfaceOnblockEvent indicates that a flight has arrived at its gate.
+	SurfaceOnblockEvent Event = "surface_onblock"
+)
+
+// AllEvents lists every Event, for subscribing to everything the account has access to. Keepalive messages are not
+// an event; they are requested with InitCommand.Keepalive.
+var AllEvents = []Event{
+	PositionEvent,
+	FlightPlanEvent,
+	DepartureEvent,
+	ArrivalEvent,
+	CancellationEvent,
+	GroundPositionEvent,
+	FmsWxEvent,
+	PowerOnEvent,
+	ExtendedFlightInfoEvent,
+	VehiclePositionEvent,
+	SurfaceOffblockEvent,
+	SurfaceOnblockEvent,
+}
+
+// ParseEvent returns the Event with the given name, or an error if there is no such event.
+func ParseEvent(s string) (Event, error) {
+	for _, e := range AllEvents {
+		if string(e) == s {
+			return e, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event %q", s)
+}
+
+// Compression identifies a compression algorithm which the server can apply to the data it sends.
+type Compression string
+
+const (
+	// CompressionNone indicates that data is sent uncompressed.
+	CompressionNone Compression = ""
+	// CompressionGzip indicates gzip compression (RFC 1952).
+	CompressionGzip Compression = "gzip"
+	// CompressionCompress indicates zlib compression (RFC 1950).
+	CompressionCompress Compression = "compress"
+	// CompressionDeflate indicates raw DEFLATE compression (RFC 1951).
+	CompressionDeflate Compression = "deflate"
 )
 
 // A Rectangle indicates a lat/lon bounding box.
@@ -32,6 +107,94 @@ type Rectangle struct {
 	HiLon float64
 }
 
+// Validate reports whether the Rectangle can be used as a Firehose latlong filter: latitudes must lie within [-90, 90]
+// and longitudes within [-180, 180], and each low bound must not exceed the corresponding high bound.
+//
+// A Rectangle whose LowLon is greater than its HiLon describes a box crossing the antimeridian. Contains understands
+// such boxes, but Firehose cannot express them as a single rectangle, so Validate rejects them; see Split.
+func (r Rectangle) Validate() error {
+	switch {
+	case r.LowLat < -90 || r.LowLat > 90 || r.HiLat < -90 || r.HiLat > 90:
+		return fmt.Errorf("latitude out of range [-90, 90] in rectangle %v", r)
+	case r.LowLon < -180 || r.LowLon > 180 || r.HiLon < -180 || r.HiLon > 180:
+		return fmt.Errorf("longitude out of range [-180, 180] in rectangle %v", r)
+	case r.LowLat > r.HiLat:
+		return fmt.Errorf("low latitude exceeds high latitude in rectangle %v", r)
+	case r.LowLon > r.HiLon:
+		return fmt.Errorf("low longitude exceeds high longitude in rectangle %v", r)
+	}
+	return nil
+}
+
+// Split returns the Rectangle as a list of rectangles which each satisfy the longitude ordering required by Validate.
+// A Rectangle crossing the antimeridian, with LowLon greater than HiLon, is split into the part from LowLon to 180 and
+// the part from -180 to HiLon, which together cover the same area. Any other Rectangle is returned unchanged.
+func (r Rectangle) Split() []Rectangle {
+	if r.LowLon <= r.HiLon {
+		return []Rectangle{r}
+	}
+	east, west := r, r
+	east.HiLon = 180
+	west.LowLon = -180
+	return []Rectangle{east, west}
+}
+
+// Contains reports whether the point at lat, lon lies within the Rectangle, including its edges. If LowLon is greater
+// than HiLon, the Rectangle is taken to cross the antimeridian, covering the longitudes from LowLon eastward to 180 and
+// from -180 eastward to HiLon.
+func (r Rectangle) Contains(lat, lon float64) bool {
+	if lat < r.LowLat || lat > r.HiLat {
+		return false
+	}
+	if r.LowLon > r.HiLon {
+		return lon >= r.LowLon || lon <= r.HiLon
+	}
+	return lon >= r.LowLon && lon <= r.HiLon
+}
+
+// MergeRectangles reduces a set of rectangles to an equivalent, usually smaller, set covering exactly the same area,
+// which shortens the init command when the rectangles are generated, for example by tiling a region. Rectangles
+// crossing the antimeridian are first split as by Split. A rectangle lying entirely within another is then dropped, and
+// two rectangles which span the same latitudes and overlap or touch in longitude, or the reverse, are coalesced into
+// one, until no further reduction is possible. The remaining rectangles keep the order in which they first appeared.
+func MergeRectangles(rects []Rectangle) []Rectangle {
+	var merged []Rectangle
+	for _, r := range rects {
+		merged = append(merged, r.Split()...)
+	}
+	for reduced := true; reduced; {
+		reduced = false
+	search:
+		for i := range merged {
+			for j := i + 1; j < len(merged); j++ {
+				if u, ok := rectangleUnion(merged[i], merged[j]); ok {
+					merged[i] = u
+					merged = append(merged[:j], merged[j+1:]...)
+					reduced = true
+					break search
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// rectangleUnion returns the rectangle covering exactly the area of a and b together, reporting false if there is
+// none. Neither rectangle may cross the antimeridian.
+func rectangleUnion(a, b Rectangle) (Rectangle, bool) {
+	switch {
+	case a.LowLat <= b.LowLat && a.HiLat >= b.HiLat && a.LowLon <= b.LowLon && a.HiLon >= b.HiLon:
+		return a, true
+	case b.LowLat <= a.LowLat && b.HiLat >= a.HiLat && b.LowLon <= a.LowLon && b.HiLon >= a.HiLon:
+		return b, true
+	case a.LowLat == b.LowLat && a.HiLat == b.HiLat && a.LowLon <= b.HiLon && b.LowLon <= a.HiLon:
+		return Rectangle{LowLat: a.LowLat, LowLon: min(a.LowLon, b.LowLon), HiLat: a.HiLat, HiLon: max(a.HiLon, b.HiLon)}, true
+	case a.LowLon == b.LowLon && a.HiLon == b.HiLon && a.LowLat <= b.HiLat && b.LowLat <= a.HiLat:
+		return Rectangle{LowLat: min(a.LowLat, b.LowLat), LowLon: a.LowLon, HiLat: max(a.HiLat, b.HiLat), HiLon: a.HiLon}, true
+	}
+	return Rectangle{}, false
+}
+
 // InitCommand helps build and serialize an initiation command string which can be provided as the argument to
 // Stream.Init.
 //
@@ -57,6 +220,25 @@ type InitCommand struct {
 	//
 	// For example: "CYUL" or "K??? P* TJSJ"
 	AirportFilter []string
+	// AirlineFilter requests information only for flights operated by airlines whose ICAO codes match the space
+	// separated list of glob patterns provided.
+	//
+	// For example: "UAL" or "UAL DAL AA?"
+	AirlineFilter []string
+	// IdentFilter requests information only for flights whose idents match the space separated list of glob patterns
+	// provided.
+	//
+	// For example: "UAL123" or "N12* SWA*"
+	//
+	// A flight is sent if it matches any of AirportFilter, AirlineFilter, IdentFilter, AircraftTypeFilter, or
+	// LatLong. Once a flight has been matched, all subsequent messages for that flight ID continue to be sent even if
+	// it no longer matches.
+	IdentFilter []string
+	// AircraftTypeFilter requests information only for flights whose ICAO aircraft type codes match the space
+	// separated list of glob patterns provided.
+	//
+	// For example: "B77W B789" or "A38? B74*"
+	AircraftTypeFilter []string
 	// Events specifies a list of downlink messages which should be sent.
 	//
 	// If not specified default behavior is to deliver all Airborne Feed messages enabled in the Firehose Subscription.
@@ -66,10 +248,64 @@ type InitCommand struct {
 	// ignored, unless the flight has already been matched by other criteria. Once a flight has been matched by a
 	// latlong rectangle, it becomes remembered and all subsequent messages until landing for that flight ID will
 	// continue to be sent even if the flight no longer matches a specified rectangle.
+	//
+	// A rectangle crossing the antimeridian is sent as the two rectangles returned by its Split method.
 	LatLong []Rectangle
+	// MergeLatLong sends the LatLong rectangles reduced by MergeRectangles, which covers the same area with fewer
+	// rectangles when they overlap or adjoin.
+	MergeLatLong bool
+	// Keepalive requests that the server send a KeepaliveMessage at this interval, which makes it possible to detect a
+	// dead connection during quiet periods. The interval is sent in whole seconds, rounded up, so an interval shorter
+	// than a second requests a keepalive every second.
+	Keepalive time.Duration
+	// Compression requests that the server compress the data it sends. The Stream must be told to expect compressed
+	// data by creating it with the WithCompression option, using the same value.
+	Compression Compression
+	// Version pins the version of the Firehose message format, such as "26.0", so that the fields sent do not change
+	// when a new version is released. If empty, the server's current version is used. It must not contain spaces.
+	//
+	// The server does not acknowledge the version; a version it does not support is reported as an ErrorMessage.
+	Version string
+	// RawArgs are appended to the serialized command after every other field, separated by spaces, so that an
+	// argument which this package does not yet support can be used. They are sent verbatim: values are neither quoted
+	// nor escaped, and the caller is responsible for producing arguments which the server accepts.
+	RawArgs []string
+	// AltitudeFilter restricts the position messages returned to those reporting an altitude within the range.
+	//
+	// Firehose does not document an altitude filter for the init command, so this filter is not sent to the server and
+	// does not reduce the volume of data received. Instead, a Stream to which the command is sent with InitWith
+	// discards position messages outside the range, including those without a valid altitude, before they are
+	// returned. Other messages are unaffected.
+	//
+	// String leaves the filter out, so it has no effect when the command is sent with Init(cmd.String()). An argument
+	// which the server does support can be passed through with RawArgs.
+	AltitudeFilter *AltitudeRange
+	// ExcludeUpdateTypes lists the sources of position reports which should not be returned, such as
+	// UpdateTypeEstimated to receive only observed positions.
+	//
+	// Firehose does not document a way to exclude update types in the init command, so, as for AltitudeFilter, this is
+	// not sent to the server. A Stream to which the command is sent with InitWith discards position, ground position,
+	// and vehicle position messages of the listed types before they are returned.
+	ExcludeUpdateTypes []UpdateType
+}
+
+// An AltitudeRange is a band of altitudes, in feet.
+type AltitudeRange struct {
+	// Min is the lowest altitude included in the range.
+	Min int
+	// Max is the highest altitude included in the range, or zero for no upper limit.
+	Max int
+}
+
+// Contains reports whether alt lies within the range, including its bounds.
+func (r AltitudeRange) Contains(alt int) bool {
+	return alt >= r.Min && (r.Max == 0 || alt <= r.Max)
 }
 
 // String converts the InitCommand to a string suitable for passing to Stream.Init.
+//
+// The credentials and filters are quoted, with any backslashes, double quotes, and line breaks within them escaped, so
+// that they cannot alter the structure of the command.
 func (i *InitCommand) String() string {
 	var parts []string
 
@@ -85,12 +321,23 @@ func (i *InitCommand) String() string {
 		parts = append(parts, "range", i.Range.Start, i.Range.End)
 	}
 
-	parts = append(parts, "username", i.Username)
-	parts = append(parts, "password", i.Password)
+	parts = append(parts, "username", quote(i.Username))
+	parts = append(parts, "password", quote(i.Password))
 
 	if len(i.AirportFilter) > 0 {
-		filter := fmt.Sprintf("\"%s\"", strings.Join(i.AirportFilter, " "))
-		parts = append(parts, "airport_filter", filter)
+		parts = append(parts, "airport_filter", quote(strings.Join(i.AirportFilter, " ")))
+	}
+
+	if len(i.AirlineFilter) > 0 {
+		parts = append(parts, "airline_filter", quote(strings.Join(i.AirlineFilter, " ")))
+	}
+
+	if len(i.IdentFilter) > 0 {
+		parts = append(parts, "ident_filter", quote(strings.Join(i.IdentFilter, " ")))
+	}
+
+	if len(i.AircraftTypeFilter) > 0 {
+		parts = append(parts, "type_filter", quote(strings.Join(i.AircraftTypeFilter, " ")))
 	}
 
 	if len(i.Events) > 0 {
@@ -98,18 +345,87 @@ func (i *InitCommand) String() string {
 		for _, e := range i.Events {
 			events = append(events, string(e))
 		}
-		filter := fmt.Sprintf("\"%s\"", strings.Join(events, " "))
-		parts = append(parts, "events", filter)
+		parts = append(parts, "events", quote(strings.Join(events, " ")))
 	}
 
-	for _, rect := range i.LatLong {
-		filter := fmt.Sprintf("\"%f %f %f %f\"", rect.LowLat, rect.LowLon, rect.HiLat, rect.HiLon)
-		parts = append(parts, "latlong", filter)
+	latLong := i.LatLong
+	if i.MergeLatLong {
+		latLong = MergeRectangles(latLong)
+	}
+	for _, rect := range latLong {
+		for _, rect := range rect.Split() {
+			filter := fmt.Sprintf("\"%f %f %f %f\"", rect.LowLat, rect.LowLon, rect.HiLat, rect.HiLon)
+			parts = append(parts, "latlong", filter)
+		}
+	}
+
+	if i.Keepalive > 0 {
+		parts = append(parts, "keepalive", strconv.Itoa(int((i.Keepalive+time.Second-1)/time.Second)))
 	}
 
+	if i.Compression != CompressionNone {
+		parts = append(parts, "compression", string(i.Compression))
+	}
+
+	if i.Version != "" {
+		parts = append(parts, "version", i.Version)
+	}
+
+	parts = append(parts, i.RawArgs...)
+
 	return strings.Join(parts, " ")
 }
 
+// quoter escapes characters which would otherwise end a quoted argument or the command itself.
+var quoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+// quote returns s as a double-quoted init command argument.
+func quote(s string) string {
+	return `"` + quoter.Replace(s) + `"`
+}
+
+// Validate reports whether the InitCommand can be sent to Firehose: exactly one of Live, PITR, and Range must be set,
+// the credentials must be present, any AltitudeFilter must not be inverted, and every LatLong rectangle must be valid.
+// The returned error wraps ErrInvalidInitCommand.
+func (i *InitCommand) Validate() error {
+	modes := 0
+	for _, set := range []bool{i.Live, i.PITR != "", i.Range != nil} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		return fmt.Errorf("%w: exactly one of live, pitr, and range must be set", ErrInvalidInitCommand)
+	}
+	if i.Username == "" {
+		return fmt.Errorf("%w: username is required", ErrInvalidInitCommand)
+	}
+	if i.Password == "" {
+		return fmt.Errorf("%w: password is required", ErrInvalidInitCommand)
+	}
+	if strings.ContainsAny(i.Version, " \t") {
+		return fmt.Errorf("%w: version %q contains spaces", ErrInvalidInitCommand, i.Version)
+	}
+	if r := i.AltitudeFilter; r != nil && r.Max != 0 && r.Min > r.Max {
+		return fmt.Errorf("%w: altitude filter minimum %d exceeds maximum %d", ErrInvalidInitCommand, r.Min, r.Max)
+	}
+	for _, rect := range i.LatLong {
+		for _, rect := range rect.Split() {
+			if err := rect.Validate(); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidInitCommand, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Redacted returns the serialized InitCommand with the password masked, making it suitable for logging.
+func (i *InitCommand) Redacted() string {
+	redacted := *i
+	redacted.Password = "REDACTED"
+	return redacted.String()
+}
+
 // A PITRRange denotes a specific time range to fetch.
 type PITRRange struct {
 	// Start is the starting PITR.
@@ -120,15 +436,107 @@ type PITRRange struct {
 	End string
 }
 
+// PITRFromTime formats t as a PITR, in POSIX epoch seconds, suitable for InitCommand.PITR or a PITRRange. Any
+// fractional second is truncated.
+func PITRFromTime(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// NewPITRRange creates a PITRRange covering the time from start to end. An error wrapping ErrInvalidInitCommand is
+// returned unless start precedes end once both are truncated to whole seconds.
+//
+// For example, to request the last six hours of data:
+//
+//	now := time.Now()
+//	r, err := firehose.NewPITRRange(now.Add(-6*time.Hour), now)
+func NewPITRRange(start, end time.Time) (*PITRRange, error) {
+	if start.Unix() >= end.Unix() {
+		return nil, fmt.Errorf("%w: range start %v does not precede end %v", ErrInvalidInitCommand, start, end)
+	}
+	return &PITRRange{Start: PITRFromTime(start), End: PITRFromTime(end)}, nil
+}
+
+// CredentialsFromEnv returns the Firehose username and password from the FIREHOSE_USERNAME and FIREHOSE_PASSWORD
+// environment variables, suitable for InitCommand.Username and InitCommand.Password. ok is false unless both are set
+// and non-empty.
+func CredentialsFromEnv() (user, pass string, ok bool) {
+	user = os.Getenv("FIREHOSE_USERNAME")
+	pass = os.Getenv("FIREHOSE_PASSWORD")
+	return user, pass, user != "" && pass != ""
+}
+
 // Connect is a simple way to open a Firehose stream using the default configuration.
 //
-// To customize your connection, use NewStream instead.
+// To customize your connection, use Dial or NewStream instead.
 func Connect() (*Stream, error) {
-	conn, err := tls.Dial("tcp", DefaultAddress, nil)
+	return ConnectContext(context.Background())
+}
+
+// ConnectContext is like Connect, but gives up on establishing the connection when ctx is done. Once ConnectContext
+// returns, cancelling ctx has no effect on the Stream.
+func ConnectContext(ctx context.Context) (*Stream, error) {
+	return Dial(ctx)
+}
+
+// Dial opens a Firehose stream, applying the provided options.
+//
+// By default, the connection is made to DefaultAddress over TLS with the system's default certificate verification;
+// see WithAddress, WithTLSConfig, and WithDialer. The context bounds the time spent establishing the connection; once
+// Dial returns, cancelling it has no effect on the Stream.
+func Dial(ctx context.Context, opts ...Option) (*Stream, error) {
+	o := newOptions(opts)
+	netDialer := &net.Dialer{}
+	if o.dialer != nil {
+		d := *o.dialer
+		netDialer = &d
+	}
+	if o.localAddr != nil {
+		netDialer.LocalAddr = o.localAddr
+	}
+	dialer := &tls.Dialer{
+		NetDialer: netDialer,
+		Config:    o.tlsConfig,
+	}
+	if o.insecure {
+		o.logger.Warn("certificate verification is disabled")
+		dialer.Config = cloneConfig(dialer.Config)
+		dialer.Config.InsecureSkipVerify = true
+	}
+	if len(o.pinnedCerts) > 0 {
+		dialer.Config = pinCertificates(dialer.Config, o.pinnedCerts)
+	}
+	o.logger.Info("connecting to firehose", "address", o.address)
+	var conn net.Conn
+	var err error
+	if o.proxy != "" {
+		conn, err = dialTLSViaProxy(ctx, netDialer, dialer.Config, o.proxy, o.address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", o.address)
+	}
 	if err != nil {
+		o.logger.Warn("could not connect to firehose", "address", o.address, "error", err)
+		return nil, err
+	}
+	o.logger.Info("connected to firehose", "address", o.address, "local_addr", conn.LocalAddr().String())
+	return newStream(conn, o), nil
+}
+
+// OpenStream connects to Firehose with Dial and sends cmd with InitWith, both under ctx, returning a Stream ready to be
+// read. If WithInitTimeout is among opts, OpenStream also waits for the server to respond to the command. If any step
+// fails or ctx is done first, the connection is closed, so that a cancelled startup leaves nothing open.
+func OpenStream(ctx context.Context, cmd InitCommand, opts ...Option) (*Stream, error) {
+	if err := cmd.Validate(); err != nil {
 		return nil, err
 	}
-	return NewStream(conn), nil
+	stream, err := Dial(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect: %w", err)
+	}
+	if err := stream.InitWith(ctx, cmd); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("could not initialize stream: %w", err)
+	}
+	return stream, nil
 }
 
 // NewStream creates a new Firehose Stream over the provided network connection.
@@ -138,17 +546,99 @@ func Connect() (*Stream, error) {
 //
 // If you don't want to do any customization, you can use Connect instead to easily open a Stream with the default
 // configuration options.
-func NewStream(conn net.Conn) *Stream {
-	return &Stream{
+func NewStream(conn net.Conn, opts ...Option) *Stream {
+	return newStream(conn, newOptions(opts))
+}
+
+// NewReader creates a Stream which decodes messages from r rather than from a live connection, for example to replay
+// newline-delimited JSON captured from Firehose or written by a Recorder.
+//
+// Messages are read with NextMessage, Messages, or All just as from a live connection, and reading ends with io.EOF
+// once r is exhausted. Such a Stream has no server to talk to, so Init returns ErrNotConnected. Close closes r if it
+// implements io.Closer.
+func NewReader(r io.Reader, opts ...Option) *Stream {
+	c := newStream(nil, newOptions(opts))
+	c.src = r
+	return c
+}
+
+// newStream creates a Stream over conn using the already assembled options.
+func newStream(conn net.Conn, o options) *Stream {
+	c := &Stream{
 		conn:    conn,
-		decoder: json.NewDecoder(conn),
+		src:     conn,
+		opts:    o,
+		created: time.Now(),
+	}
+	if o.tee != nil {
+		c.tee = newTee(o.tee)
+	}
+	if o.clockFlights > 0 {
+		c.clocks = newClockCheck(o.clockFlights, o.clockReport)
 	}
+	if o.bufferSize > 0 {
+		// The channel is made up front rather than when the decoder starts, so that Buffered can read it at any time.
+		c.buffer.ch = make(chan bufferedMessage, o.bufferSize)
+	}
+	return c
 }
 
 // A Stream implements the Firehose protocol over a net.Conn.
+//
+// Messages are read from the connection one line at a time, since the server delimits each JSON message with a
+// newline.
+//
+// A Stream has a single reader: only one call to NextMessage may be in progress at a time, including the calls made on
+// behalf of Messages and All. A call made while another is in progress fails immediately with ErrConcurrentRead and
+// leaves the Stream unaffected. PITR, Stats, LastReceived, CheckLiveness, Buffered, and Close may be called at any
+// time.
 type Stream struct {
-	conn    net.Conn
-	decoder *json.Decoder
+	// conn is the connection to the server, or nil if the Stream was created by NewReader.
+	conn net.Conn
+	// src is the source of the data to decode, which is conn unless the Stream was created by NewReader.
+	src  io.Reader
+	opts options
+	// pitr holds the PITR of the most recently returned message which had one.
+	pitr atomic.Value
+	// err holds the error which ended Messages.
+	err atomic.Pointer[error]
+	// tee receives a copy of every line read, if WithTee was used.
+	tee *tee
+	// lastReceived is the time at which the most recent message was read, for WithKeepaliveTimeout.
+	lastReceived time.Time
+	// received holds the time of the most recent message in Unix nanoseconds, or zero if none has been read, for
+	// CheckLiveness, which may be called from other goroutines. created is the time the Stream was created.
+	received atomic.Int64
+	created  time.Time
+	stats    streamStats
+	// reader is created on the first read, since a decompressor may block reading its header.
+	reader *bufio.Reader
+	// line holds the message currently being read, and is reused between messages.
+	line []byte
+	// partial indicates that line holds the beginning of a message whose read was interrupted, and tooLarge that the
+	// message has already been found to exceed the maximum size.
+	partial, tooLarge bool
+	// buffer holds the state of the background decoder started by the first read if WithBuffer was used.
+	buffer messageBuffer
+	// altitude is the AltitudeFilter of the command sent with InitWith, if any, and excluded its ExcludeUpdateTypes.
+	altitude *AltitudeRange
+	excluded []UpdateType
+	// latLong is the LatLong filter of the command sent with InitWith, for InLatLong.
+	latLong []Rectangle
+	// pending holds the first message, read by InitWith if WithInitTimeout was used, until it is returned by
+	// NextMessage.
+	pending *bufferedMessage
+	// clocks tracks the latest clock of each flight if WithClockCheck was used.
+	clocks *clockCheck
+	// readMu is held while a call to NextMessage is in progress, so that Close can wait for it to finish.
+	readMu sync.Mutex
+	// closed is set once Close has been called, and closeErr holds the error it returned.
+	closed    atomic.Bool
+	closeOnce sync.Once
+	closeErr  error
+	// ranged indicates that the init command requested a Range, so that the server closing the connection marks the
+	// end of the range.
+	ranged bool
 }
 
 // Init sends the provided init command.
@@ -156,10 +646,192 @@ type Stream struct {
 // Init must be called after the stream is initially created. You can use the InitCommand struct to help create a
 // command string, or you can provide your own.
 //
+// The command must be a single line. A command containing a line break is rejected with an error wrapping
+// ErrInvalidInitCommand, since the server would interpret everything after the break as further input.
+//
+// Init waits as long as it takes to send the command unless a timeout is set with WithWriteTimeout; InitWith also
+// accepts a context.
+//
 // For details about the init command, see https://www.flightaware.com/commercial/firehose/documentation/commands.
 func (c *Stream) Init(command string) error {
+	return c.send(context.Background(), command)
+}
+
+// InitWith validates cmd and sends it as the init command. It is the preferred alternative to Init when the command is
+// built with InitCommand.
+//
+// If cmd requests compression, the Stream is configured to decompress the data it receives accordingly, so
+// WithCompression is not needed. InitWith gives up on sending the command when ctx is done.
+//
+// If WithInitTimeout was used, InitWith then waits for the first message from the server; see WithInitTimeout.
+func (c *Stream) InitWith(ctx context.Context, cmd InitCommand) error {
+	if err := cmd.Validate(); err != nil {
+		return err
+	}
+	c.opts.logger.Debug("sending init command", "command", cmd.Redacted())
+	if err := c.send(ctx, cmd.String()); err != nil {
+		return err
+	}
+
+	if cmd.Compression != CompressionNone && c.reader == nil {
+		c.opts.compression = cmd.Compression
+	}
+	if cmd.AltitudeFilter != nil {
+		r := *cmd.AltitudeFilter
+		c.altitude = &r
+	}
+	c.excluded = append([]UpdateType(nil), cmd.ExcludeUpdateTypes...)
+	c.latLong = append([]Rectangle(nil), cmd.LatLong...)
+	if c.opts.initTimeout > 0 {
+		return c.awaitFirstMessage(ctx)
+	}
+	return nil
+}
+
+// awaitFirstMessage reads the first message sent in response to the init command, keeping it to be returned by the
+// next call to NextMessage, and reports an error if the server rejected the command or sent nothing in time.
+func (c *Stream) awaitFirstMessage(ctx context.Context) error {
+	if !c.readMu.TryLock() {
+		return ErrConcurrentRead
+	}
+	defer c.readMu.Unlock()
+
+	deadline := time.Now().Add(c.opts.initTimeout)
+	readCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	msg, err := c.deliver(c.next(readCtx))
+	// The connection's deadline may pass moments before readCtx reports that it is done, so the two deadlines are
+	// compared to tell whether the timeout or ctx ended the read.
+	parent, ok := ctx.Deadline()
+	if errors.Is(err, context.DeadlineExceeded) && (!ok || !parent.Before(deadline)) {
+		c.opts.logger.Warn("no response to init command", "timeout", c.opts.initTimeout)
+		return ErrInitTimeout
+	}
+	var em *ErrorMessage
+	if errors.As(err, &em) {
+		return err
+	}
+	if err != nil && msg == nil && !errors.Is(err, ErrMessageTooLarge) {
+		return err
+	}
+	// Anything else shows that the server accepted the command, even a message which could not be decoded.
+	c.pending = &bufferedMessage{msg, err}
+	return nil
+}
+
+// send writes command to the connection, giving up when ctx is done or the timeout set with WithWriteTimeout passes.
+func (c *Stream) send(ctx context.Context, command string) error {
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	if strings.ContainsAny(command, "\r\n") {
+		return fmt.Errorf("%w: command contains a line break", ErrInvalidInitCommand)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// As for reads, apply the earlier of the context's deadline and the configured timeout.
+	deadline, hasDeadline := ctx.Deadline()
+	var timeoutErr error
+	if hasDeadline {
+		timeoutErr = context.DeadlineExceeded
+	}
+	if d := c.opts.writeTimeout; d > 0 {
+		if t := time.Now().Add(d); timeoutErr == nil || t.Before(deadline) {
+			deadline = t
+			timeoutErr = fmt.Errorf("%w: could not send init command within %s", ErrWriteTimeout, d)
+		}
+	}
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return fmt.Errorf("could not set write deadline: %w", err)
+	}
+	stop := interruptOnDone(ctx, c.conn.SetWriteDeadline)
 	_, err := fmt.Fprintln(c.conn, command)
-	return err
+	stop()
+	if err != nil {
+		c.opts.logger.Warn("could not send init command", "error", err)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if timeoutErr != nil {
+				return timeoutErr
+			}
+		}
+		return err
+	}
+	c.conn.SetWriteDeadline(time.Time{})
+	c.opts.logger.Info("sent init command")
+
+	if fields := strings.Fields(command); len(fields) > 0 && fields[0] == "range" {
+		c.ranged = true
+	}
+	return nil
+}
+
+// interruptOnDone arranges for setDeadline to be called with a time in the past if ctx is done before the returned
+// function is called, interrupting any read or write blocked on the connection. The returned function must be called
+// once the operation has finished; it does not return until any interruption is complete.
+//
+// No goroutine is started unless ctx is done, so a long-lived context may be passed to every call without cost.
+func interruptOnDone(ctx context.Context, setDeadline func(time.Time) error) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(interrupted)
+		setDeadline(time.Unix(1, 0))
+	})
+	return func() {
+		if !stop() {
+			<-interrupted
+		}
+	}
+}
+
+// LastReceived returns the time at which the most recent message of any type was read from the Stream, or the zero
+// time if none has been read.
+func (c *Stream) LastReceived() time.Time {
+	if ns := c.received.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// CheckLiveness reports whether the Stream appears to be alive, returning nil if a message of any type has been read
+// within the given interval, and an error wrapping ErrStale otherwise. Before the first message has been read, the
+// interval is measured from the creation of the Stream.
+//
+// Firehose has no request and response which could be used to probe the connection, so liveness can only be judged
+// from the messages being read. Request keepalives with InitCommand.Keepalive at an interval comfortably shorter than
+// the one checked, so that a quiet feed is not mistaken for a dead connection, and make sure the Stream is being read.
+// CheckLiveness may be called concurrently with reads, for example from a health check endpoint.
+func (c *Stream) CheckLiveness(within time.Duration) error {
+	last := c.LastReceived()
+	if last.IsZero() {
+		last = c.created
+	}
+	if since := time.Since(last); since > within {
+		return fmt.Errorf("%w: no message received for %s", ErrStale, since.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// Stats returns the counters accumulated while reading from the Stream. It may be called concurrently with reads, for
+// example to export metrics periodically.
+func (c *Stream) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// PITR returns the point-in-time-recovery value of the most recent message returned by NextMessage which carried
+// one, or an empty string if there has not been such a message.
+//
+// This is the value to supply as InitCommand.PITR to resume the feed from where this Stream left off.
+func (c *Stream) PITR() string {
+	pitr, _ := c.pitr.Load().(string)
+	return pitr
 }
 
 // Message encapsulates a message received from the Firehose Stream.
@@ -172,34 +844,162 @@ type Message struct {
 	//
 	// Generally, you will want to use a type switch to handle messages of various types. See the README for an example.
 	Payload any
+	// PITR is the point-in-time-recovery value carried by the message, if any.
+	PITR string
+	// Raw holds a copy of the message exactly as it was received, without its line terminator, if the Stream was
+	// created with WithRawMessages. It is not affected by an Enricher, and is not set by UnmarshalJSON.
+	Raw json.RawMessage
+}
+
+// MarshalJSON implements json.Marshaler for Message, producing the JSON of the payload as it would be sent by
+// Firehose, so that it can be decoded again with UnmarshalJSON. An UnknownMessage is produced exactly as received.
+//
+// Type and PITR are added to the payload's JSON if it does not already carry them, as for a payload constructed by hand
+// or of a type which has no PITR field.
+func (m Message) MarshalJSON() ([]byte, error) {
+	if u, ok := m.Payload.(UnknownMessage); ok && len(u.Raw) > 0 {
+		return u.Raw, nil
+	}
+	data := []byte("{}")
+	if m.Payload != nil {
+		var err error
+		if data, err = json.Marshal(m.Payload); err != nil {
+			return nil, err
+		}
+	}
+	var stub struct {
+		Type string `json:"type"`
+		PITR string `json:"pitr"`
+	}
+	if err := json.Unmarshal(data, &stub); err != nil {
+		return nil, fmt.Errorf("payload of %s message is not a JSON object: %w", m.Type, err)
+	}
+	if m.Type != "" && stub.Type != m.Type {
+		data = appendField(data, "type", m.Type)
+	}
+	if m.PITR != "" && stub.PITR != m.PITR {
+		data = appendField(data, "pitr", m.PITR)
+	}
+	return data, nil
+}
+
+// appendField adds a string field to the end of a JSON object. A field already present with the same name is
+// overridden when the object is decoded, since the last occurrence of a name takes precedence.
+func appendField(obj []byte, name, value string) []byte {
+	field, _ := json.Marshal(map[string]string{name: value})
+	obj = bytes.TrimRight(obj, " \t\r\n")
+	if len(obj) > 2 {
+		obj = append(obj[:len(obj)-1], ',')
+	} else {
+		obj = obj[:len(obj)-1]
+	}
+	return append(obj, field[1:]...)
 }
 
 // UnmarshalJSON implements json.Unmarshaler for Message.
+//
+// Fields are decoded leniently: a JSON number is accepted for a field declared as a string, and is stored in its
+// string form, while a numeric string is accepted for a field declared as a number.
 func (m *Message) UnmarshalJSON(data []byte) error {
 	var stub struct {
 		Type string `json:"type"`
+		PITR string `json:"pitr"`
 	}
-	if err := json.Unmarshal(data, &stub); err != nil {
+	if err := unmarshalLenient(data, &stub); err != nil {
 		return fmt.Errorf("could not determine message type: %w", err)
 	}
 	m.Type = stub.Type
+	m.PITR = stub.PITR
 
 	switch m.Type {
 	case "error":
 		var payload ErrorMessage
-		err := json.Unmarshal(data, &payload)
+		err := unmarshalLenient(data, &payload)
 		m.Payload = payload
 		return err
 	case "position":
 		var payload PositionMessage
-		err := json.Unmarshal(data, &payload)
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "flightplan":
+		var payload FlightPlanMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "departure":
+		var payload DepartureMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "arrival":
+		var payload ArrivalMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "cancellation":
+		var payload CancellationMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "ground_position":
+		var payload GroundPositionMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "fmswx":
+		var payload FmsWxMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "extendedFlightInfo":
+		var payload ExtendedFlightInfoMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "vehicleposition":
+		var payload VehiclePositionMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "power_on":
+		var payload PowerOnMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "surface_offblock":
+		var payload SurfaceOffblockMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "surface_onblock":
+		var payload SurfaceOnblockMessage
+		err := unmarshalLenient(data, &payload)
+		m.Payload = payload
+		return err
+	case "keepalive":
+		var payload KeepaliveMessage
+		err := unmarshalLenient(data, &payload)
 		m.Payload = payload
 		return err
 	default:
-		return fmt.Errorf("unrecognized message type: %s", m.Type)
+		m.Payload = UnknownMessage{
+			Type: m.Type,
+			Raw:  append(json.RawMessage(nil), data...),
+		}
+		return nil
 	}
 }
 
+// UnknownMessage holds a message of a type which this package does not know how to decode, so that a stream carrying
+// new or unexpected message types can continue to be read.
+type UnknownMessage struct {
+	// Type is the type of the message, as sent by the server.
+	Type string
+	// Raw holds the complete JSON body of the message.
+	Raw json.RawMessage
+}
+
 // ErrorMessage indicates an error condition.
 type ErrorMessage struct {
 	// Type is always "error".
@@ -208,6 +1008,28 @@ type ErrorMessage struct {
 	ErrorMessage string `json:"error_msg"`
 }
 
+// Error returns the error reported by the server.
+func (e ErrorMessage) Error() string {
+	return "firehose: server error: " + e.ErrorMessage
+}
+
+// Unwrap returns the sentinel error matching the server's message: one of ErrConnectionSuperseded, ErrAuthFailed,
+// ErrConnectionLimit, or ErrInvalidFilter. It returns nil for messages which are not recognized, in which case the
+// ErrorMessage itself is the only description of the failure.
+func (e ErrorMessage) Unwrap() error {
+	return classifyServerError(e.ErrorMessage)
+}
+
+// KeepaliveMessage is sent periodically by the server when requested with InitCommand.Keepalive.
+type KeepaliveMessage struct {
+	// Type is always "keepalive".
+	Type string `json:"type"`
+	// ServerTime is the time at which the server sent the message, in POSIX epoch format.
+	ServerTime string `json:"serverTime"`
+	// PITR is the point-in-time-recovery timestamp value at the time the message was sent.
+	PITR string `json:"pitr"`
+}
+
 // Waypoint contains position data
 type Waypoint struct {
 	// Latitude in decimal degrees.
@@ -225,6 +1047,14 @@ type Waypoint struct {
 }
 
 // PositionMessage includes a position report.
+//
+// Firehose does not send a message type or field marking flights which are privacy-blocked (for example through the
+// FAA's LADD program); none is listed in https://www.flightaware.com/commercial/firehose/documentation/messages.
+// FlightAware withholds such flights, or masks their identifying fields, before they are delivered according to the
+// entitlements of the account, so no additional filtering is performed by this package. A masked field is empty or
+// absent, so the accessors which depend on it report that it is not set, as they would for any other missing field.
+// Consumers who merge Firehose data with other sources remain responsible for honoring blocking requests in those
+// sources.
 type PositionMessage struct {
 	// Type is always "position".
 	Type string `json:"type"`
@@ -239,22 +1069,9 @@ type PositionMessage struct {
 	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
 	ID string `json:"id"`
 	// UpdateType specifies the source of the message.
-	//
-	// - A for ADS-B
-	// - Z for radar
-	// - O for transoceanic
-	// - P for estimated
-	// - D for datalink
-	// - M for multilateration (MLAT)
-	// - X for ASDE-X
-	// - S for space-based ADS-B
-	UpdateType string `json:"updateType"`
+	UpdateType UpdateType `json:"updateType"`
 	// AirGround indicates whether the aircraft is on the ground.
-	//
-	// - A for Air
-	// - G for Ground
-	// - WOW for Weight-on-Wheels
-	AirGround string `json:"air_ground"`
+	AirGround AirGround `json:"air_ground"`
 	// FacilityHash is a consistent and unique obfuscated identifier string for each source reporting positions to
 	// FlightAware.
 	FacilityHash string `json:"facility_hash"`
@@ -345,7 +1162,7 @@ type PositionMessage struct {
 	// WindSpeed is the computed wind speed in knots.
 	WindSpeed string `json:"wind_speed"`
 	// TemperatureQuality is set to 0 if the derived temperature is likely to be inaccurate due to quantization errors,
-	// 0 otherwise.
+	// and 1 otherwise.
 	TemperatureQuality string `json:"temperature_quality"`
 	// Temperature is the computed outside air temperature in degrees Celsius.
 	Temperature string `json:"temperature"`
@@ -372,40 +1189,805 @@ type PositionMessage struct {
 	// The units are reported in the FuelOnBoardUnit field. This data is available for specifically authorized customers
 	// only.
 	FuelOnBoard string `json:"fuel_on_board"`
-	// FuelOnBoardUnit is the unit for FuelOnBoard.
-	//
-	// Possible values are LITERS, GALLONS, POUNDS, KILOGRAMS, or UNKNOWN. This data is available for specifically
-	// authorized customers only.
-	FuelOnBoardUnit string `json:"fuel_on_board_unit"`
-}
-
-// NextMessage reads a Message from the Stream.
-//
-// If a message cannot be read, an error is returned.
-func (c *Stream) NextMessage(ctx context.Context) (*Message, error) {
-	// If our context has a deadline, set the read deadline on our underlying connection accordingly.
-	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
-		if err := c.conn.SetReadDeadline(deadline); err != nil {
-			return nil, fmt.Errorf("could not set read deadline: %w", err)
-		}
-	}
-
-	var msg Message
-	errc := make(chan error)
-	go func() {
-		errc <- c.decoder.Decode(&msg)
-	}()
-
-	select {
-	case <-ctx.Done():
-		c.Close()
-		return nil, ctx.Err()
-	case err := <-errc:
-		return &msg, err
-	}
+	// FuelOnBoardUnit is the unit for FuelOnBoard. This data is available for specifically authorized customers only.
+	FuelOnBoardUnit FuelUnit `json:"fuel_on_board_unit"`
+	// Enrichment holds any additional data attached to the position by an Enricher. It is never populated by Firehose.
+	Enrichment any `json:"-"`
 }
 
-// Close closes the Firehose Stream and the underlying net.Conn.
-func (c *Stream) Close() error {
-	return c.conn.Close()
+// FlightPlanMessage describes a new or amended flight plan.
+type FlightPlanMessage struct {
+	// Type is always "flightplan".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// Status is the status of the flight.
+	//
+	// - S for scheduled
+	// - F for filed
+	// - A for active
+	// - Z for completed
+	// - X for cancelled
+	Status string `json:"status"`
+	// AircraftType is the ICAO aircraft type code.
+	AircraftType string `json:"aircrafttype"`
+	// Alt is the filed cruising altitude in feet (MSL).
+	Alt string `json:"alt"`
+	// Speed is the filed cruising speed in knots.
+	Speed string `json:"speed"`
+	// Orig is the origin ICAO airport code, waypoint, or latitude/longitude pair.
+	Orig string `json:"orig"`
+	// Dest is the destination ICAO airport code, waypoint, or latitude/longitude pair.
+	Dest string `json:"dest"`
+	// FDT is the filed departure time in POSIX epoch format.
+	FDT string `json:"fdt"`
+	// EDT is the revised timestamp of when the flight is expected to depart in POSIX epoch format.
+	EDT string `json:"edt"`
+	// ETA is the estimated time of arrival in POSIX epoch format.
+	ETA string `json:"eta"`
+	// ETE is the en route time in seconds.
+	ETE string `json:"ete"`
+	// Route is a textual route string.
+	Route string `json:"route"`
+	// Waypoints is an array of 2D, 3D, or 4D objects of locations, times, and altitudes along the filed route.
+	Waypoints []Waypoint `json:"waypoints"`
+	// Reg is the tail number or registration of the aircraft, if known and it differs from the ident.
+	Reg string `json:"reg"`
+	// Hexid is the transponder Mode S code, formatted in upper case hexadecimal.
+	Hexid string `json:"hexid"`
+	// ATCIdent is an identifier used for ATC, if that differs from the flight identifier.
+	ATCIdent string `json:"atcident"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source of the flight plan.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source of the flight plan. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// DepartureMessage reports that a flight has departed.
+type DepartureMessage struct {
+	// Type is always "departure".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// AircraftType is the ICAO aircraft type code.
+	AircraftType string `json:"aircrafttype"`
+	// Orig is the origin ICAO airport code, waypoint, or latitude/longitude pair.
+	Orig string `json:"orig"`
+	// Dest is the destination ICAO airport code, waypoint, or latitude/longitude pair. May be missing if not known.
+	Dest string `json:"dest"`
+	// ADT is the actual departure time in POSIX epoch format.
+	ADT string `json:"adt"`
+	// ETA is the estimated time of arrival in POSIX epoch format.
+	ETA string `json:"eta"`
+	// Reg is the tail number or registration of the aircraft, if known and it differs from the ident.
+	Reg string `json:"reg"`
+	// Hexid is the transponder Mode S code, formatted in upper case hexadecimal.
+	Hexid string `json:"hexid"`
+	// ATCIdent is an identifier used for ATC, if that differs from the flight identifier.
+	ATCIdent string `json:"atcident"`
+	// Synthetic is "1" if the departure was inferred by FlightAware rather than reported by a data source.
+	Synthetic string `json:"synthetic"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the departure.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the departure. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// ArrivalMessage reports that a flight has arrived.
+type ArrivalMessage struct {
+	// Type is always "arrival".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// AircraftType is the ICAO aircraft type code.
+	AircraftType string `json:"aircrafttype"`
+	// Orig is the origin ICAO airport code, waypoint, or latitude/longitude pair.
+	Orig string `json:"orig"`
+	// Dest is the destination ICAO airport code, waypoint, or latitude/longitude pair.
+	Dest string `json:"dest"`
+	// AAT is the actual arrival time in POSIX epoch format.
+	AAT string `json:"aat"`
+	// Reg is the tail number or registration of the aircraft, if known and it differs from the ident.
+	Reg string `json:"reg"`
+	// Hexid is the transponder Mode S code, formatted in upper case hexadecimal.
+	Hexid string `json:"hexid"`
+	// ATCIdent is an identifier used for ATC, if that differs from the flight identifier.
+	ATCIdent string `json:"atcident"`
+	// Synthetic is "1" if the arrival was inferred by FlightAware rather than reported by a data source.
+	Synthetic string `json:"synthetic"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the arrival.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the arrival. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// CancellationMessage reports that a flight has been cancelled.
+type CancellationMessage struct {
+	// Type is always "cancellation".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// AircraftType is the ICAO aircraft type code.
+	AircraftType string `json:"aircrafttype"`
+	// Orig is the origin ICAO airport code, waypoint, or latitude/longitude pair.
+	Orig string `json:"orig"`
+	// Dest is the destination ICAO airport code, waypoint, or latitude/longitude pair. May be missing if not known.
+	Dest string `json:"dest"`
+	// Reg is the tail number or registration of the aircraft, if known and it differs from the ident.
+	Reg string `json:"reg"`
+	// Hexid is the transponder Mode S code, formatted in upper case hexadecimal.
+	Hexid string `json:"hexid"`
+	// ATCIdent is an identifier used for ATC, if that differs from the flight identifier.
+	ATCIdent string `json:"atcident"`
+	// TrueCancel is "1" if the flight was actually cancelled, as opposed to its flight plan merely being removed
+	// (for example because it was refiled under a different ident).
+	TrueCancel string `json:"trueCancel"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the cancellation.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the cancellation. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// GroundPositionMessage reports the position of an aircraft moving on an airport surface.
+type GroundPositionMessage struct {
+	// Type is always "ground_position".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// AircraftType is the ICAO aircraft type code.
+	AircraftType string `json:"aircrafttype"`
+	// Reg is the tail number or registration of the aircraft, if known and it differs from the ident.
+	Reg string `json:"reg"`
+	// Hexid is the transponder Mode S code, formatted in upper case hexadecimal.
+	Hexid string `json:"hexid"`
+	// Airport is the ICAO code of the airport on whose surface the aircraft is moving.
+	Airport string `json:"airport"`
+	// Lat is the latitude in decimal degrees.
+	Lat string `json:"lat"`
+	// Lon is the longitude in decimal degrees.
+	Lon string `json:"lon"`
+	// Clock is the report time in POSIX epoch format.
+	Clock string `json:"clock"`
+	// GroundSpeed is the ground speed in knots.
+	GroundSpeed string `json:"groundspeed"`
+	// Heading is the course in degrees.
+	Heading string `json:"heading"`
+	// UpdateType specifies the source of the message.
+	UpdateType UpdateType `json:"updateType"`
+	// AirGround indicates whether the aircraft is on the ground.
+	AirGround AirGround `json:"air_ground"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the position.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the position. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// FmsWxMessage carries the weather observed by an aircraft's flight management system along its route.
+type FmsWxMessage struct {
+	// Type is always "fmswx".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// AircraftType is the ICAO aircraft type code.
+	AircraftType string `json:"aircrafttype"`
+	// Reg is the tail number or registration of the aircraft, if known and it differs from the ident.
+	Reg string `json:"reg"`
+	// Hexid is the transponder Mode S code, formatted in upper case hexadecimal.
+	Hexid string `json:"hexid"`
+	// Orig is the origin ICAO airport code, waypoint, or latitude/longitude pair.
+	Orig string `json:"orig"`
+	// Dest is the destination ICAO airport code, waypoint, or latitude/longitude pair. May be missing if not known.
+	Dest string `json:"dest"`
+	// Clock is the report time in POSIX epoch format.
+	Clock string `json:"clock"`
+	// Observations holds the weather reported at each point along the route.
+	Observations []FmsWxObservation `json:"observations"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the weather.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the weather. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// FmsWxObservation is the weather reported by a flight management system at a single point.
+type FmsWxObservation struct {
+	// Name is the waypoint at which the observation was made, if any.
+	Name string `json:"name"`
+	// Latitude in decimal degrees.
+	Lat float64 `json:"lat"`
+	// Longitude in decimal degrees.
+	Lon float64 `json:"lon"`
+	// Clock is the observation time in POSIX epoch format.
+	Clock string `json:"clock"`
+	// Alt is the altitude in feet (MSL).
+	Alt string `json:"alt"`
+	// Wind is the wind at the observation point.
+	Wind FmsWxWind `json:"wind"`
+	// Temperature is the outside air temperature in degrees Celsius.
+	Temperature string `json:"temperature"`
+}
+
+// FmsWxWind is a wind observation.
+type FmsWxWind struct {
+	// Direction is the direction the wind is blowing from in degrees, relative to true North.
+	Direction string `json:"direction"`
+	// Speed is the wind speed in knots.
+	Speed string `json:"speed"`
+}
+
+// ExtendedFlightInfoMessage carries schedule, gate, and codeshare details for a flight.
+type ExtendedFlightInfoMessage struct {
+	// Type is always "extendedFlightInfo".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// AircraftType is the ICAO aircraft type code.
+	AircraftType string `json:"aircrafttype"`
+	// Reg is the tail number or registration of the aircraft, if known and it differs from the ident.
+	Reg string `json:"reg"`
+	// Orig is the origin ICAO airport code, waypoint, or latitude/longitude pair.
+	Orig string `json:"orig"`
+	// Dest is the destination ICAO airport code, waypoint, or latitude/longitude pair. May be missing if not known.
+	Dest string `json:"dest"`
+	// ScheduledOut is the scheduled gate departure time in POSIX epoch format.
+	ScheduledOut string `json:"scheduled_out"`
+	// ScheduledIn is the scheduled gate arrival time in POSIX epoch format.
+	ScheduledIn string `json:"scheduled_in"`
+	// EstimatedOut is the estimated gate departure time in POSIX epoch format.
+	EstimatedOut string `json:"estimated_out"`
+	// EstimatedIn is the estimated gate arrival time in POSIX epoch format.
+	EstimatedIn string `json:"estimated_in"`
+	// GateOrig is the departure gate at the origin airport.
+	GateOrig string `json:"gate_orig"`
+	// GateDest is the arrival gate at the destination airport.
+	GateDest string `json:"gate_dest"`
+	// TerminalOrig is the departure terminal at the origin airport.
+	TerminalOrig string `json:"terminal_orig"`
+	// TerminalDest is the arrival terminal at the destination airport.
+	TerminalDest string `json:"terminal_dest"`
+	// BaggageClaim is the baggage claim at the destination airport.
+	BaggageClaim string `json:"baggage_claim"`
+	// Codeshares lists the idents under which the flight is also marketed.
+	Codeshares []string `json:"codeshares"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// VehiclePositionMessage reports the position of a ground vehicle, such as a fuel truck or snow plow, at an airport.
+type VehiclePositionMessage struct {
+	// Type is always "vehicleposition".
+	Type string `json:"type"`
+	// ID is a unique identifier for the vehicle.
+	ID string `json:"id"`
+	// Ident is the callsign of the vehicle, if it has one.
+	Ident string `json:"ident"`
+	// VehicleType describes the kind of vehicle.
+	VehicleType string `json:"vehicle_type"`
+	// Airport is the ICAO code of the airport at which the vehicle is operating.
+	Airport string `json:"airport"`
+	// Lat is the latitude in decimal degrees.
+	Lat string `json:"lat"`
+	// Lon is the longitude in decimal degrees.
+	Lon string `json:"lon"`
+	// Clock is the report time in POSIX epoch format.
+	Clock string `json:"clock"`
+	// GroundSpeed is the ground speed in knots.
+	GroundSpeed string `json:"groundspeed"`
+	// Heading is the course in degrees.
+	Heading string `json:"heading"`
+	// UpdateType specifies the source of the message.
+	UpdateType UpdateType `json:"updateType"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the position.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the position. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// PowerOnMessage reports that an aircraft's avionics have been powered on, which may be the first sign of a flight
+// before any position is available.
+type PowerOnMessage struct {
+	// Type is always "power_on".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// AircraftType is the ICAO aircraft type code.
+	AircraftType string `json:"aircrafttype"`
+	// Reg is the tail number or registration of the aircraft, if known and it differs from the ident.
+	Reg string `json:"reg"`
+	// Hexid is the transponder Mode S code, formatted in upper case hexadecimal.
+	Hexid string `json:"hexid"`
+	// Clock is the time at which the aircraft was powered on, in POSIX epoch format.
+	Clock string `json:"clock"`
+	// Airport is the ICAO code of the airport at which the aircraft was powered on, if known.
+	Airport string `json:"airport"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the event.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the event. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// SurfaceOffblockMessage reports that a flight has pushed back or otherwise left its gate, as detected by airport
+// surface surveillance.
+type SurfaceOffblockMessage struct {
+	// Type is always "surface_offblock".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// Airport is the ICAO code of the airport.
+	Airport string `json:"airport"`
+	// Clock is the time at which the flight left the gate, in POSIX epoch format.
+	Clock string `json:"clock"`
+	// Gate is the gate or stand which the flight left, if known.
+	Gate string `json:"gate"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the event.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the event. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// SurfaceOnblockMessage reports that a flight has arrived at its gate, as detected by airport surface surveillance.
+type SurfaceOnblockMessage struct {
+	// Type is always "surface_onblock".
+	Type string `json:"type"`
+	// Ident is the callsign identifying the flight.
+	Ident string `json:"ident"`
+	// ID is the FlightAware Flight ID, a unique identifier associated with each flight.
+	ID string `json:"id"`
+	// Airport is the ICAO code of the airport.
+	Airport string `json:"airport"`
+	// Clock is the time at which the flight reached the gate, in POSIX epoch format.
+	Clock string `json:"clock"`
+	// Gate is the gate or stand at which the flight arrived, if known.
+	Gate string `json:"gate"`
+	// FacilityHash is a consistent and unique obfuscated identifier string for the source reporting the event.
+	FacilityHash string `json:"facility_hash"`
+	// FacilityName is a description of the source reporting the event. May be a blank string if undefined.
+	FacilityName string `json:"facility_name"`
+	// PITR is the point-in-time-recovery timestamp value that should be supplied to the "pitr" connection initiation
+	// command when reconnecting and you wish to resume firehose playback at that approximate position.
+	PITR string `json:"pitr"`
+}
+
+// NextMessage reads a Message from the Stream.
+//
+// If a message cannot be read, an error is returned. If the server sends an error message, the message is returned
+// with its ErrorMessage payload populated as usual, along with the same ErrorMessage as a *ErrorMessage error, which
+// can be retrieved with errors.As. Common failures can be detected with errors.Is; see ErrorMessage.Unwrap.
+//
+// If ctx is done before a message has been read, NextMessage returns the context's error but leaves the Stream open,
+// so a context can be used to bound a single read. Any part of a message received before the cancellation is kept and
+// completed by the next call. The exception is a Stream created with WithCompression: the decompressor cannot resume
+// after an interrupted read, so once a read on a compressed Stream has been cancelled, every later read fails and the
+// Stream must be closed and reconnected. A Stream created with NewReader only checks ctx before each read.
+//
+// If the init command requested a Range, ErrRangeComplete is returned once the server has sent the whole range and
+// closed the connection. Any other disconnection is reported with the underlying error, typically io.EOF.
+func (c *Stream) NextMessage(ctx context.Context) (*Message, error) {
+	if !c.readMu.TryLock() {
+		return nil, ErrConcurrentRead
+	}
+	defer c.readMu.Unlock()
+	if c.closed.Load() {
+		return nil, ErrStreamClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if p := c.pending; p != nil {
+		c.pending = nil
+		return p.msg, p.err
+	}
+	var msg *Message
+	var err error
+	if c.opts.bufferSize > 0 {
+		msg, err = c.nextBuffered(ctx)
+	} else {
+		msg, err = c.deliver(c.next(ctx))
+	}
+	if err != nil && c.closed.Load() {
+		// The read was interrupted by Close, so whatever error the connection reported is incidental.
+		return nil, ErrStreamClosed
+	}
+	return msg, err
+}
+
+// next reads the next message from the connection or reader, giving up when ctx is done or a configured timeout
+// passes.
+func (c *Stream) next(ctx context.Context) (*Message, error) {
+	if c.conn == nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return c.readMessage()
+	}
+
+	// Apply the earliest of the context's deadline and the configured timeouts to the underlying connection,
+	// remembering which error to report if it passes. Without any of them, a deadline left over from a previous call
+	// is cleared.
+	deadline, hasDeadline := ctx.Deadline()
+	var timeoutErr error
+	if hasDeadline {
+		timeoutErr = context.DeadlineExceeded
+	}
+	now := time.Now()
+	if d := c.opts.readTimeout; d > 0 {
+		if t := now.Add(d); timeoutErr == nil || t.Before(deadline) {
+			deadline = t
+			timeoutErr = fmt.Errorf("%w: no data received for %s", ErrReadTimeout, d)
+		}
+	}
+	if d := c.opts.keepaliveTimeout; d > 0 {
+		if c.lastReceived.IsZero() {
+			c.lastReceived = now
+		}
+		if t := c.lastReceived.Add(d); timeoutErr == nil || t.Before(deadline) {
+			deadline = t
+			timeoutErr = fmt.Errorf("%w: no message received for %s", ErrKeepaliveTimeout, d)
+		}
+	}
+	if err := c.conn.SetReadDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("could not set read deadline: %w", err)
+	}
+	defer interruptOnDone(ctx, c.conn.SetReadDeadline)()
+
+	msg, err := c.readMessage()
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if timeoutErr != nil {
+			c.opts.logger.Warn("read timed out", "error", timeoutErr)
+			return nil, timeoutErr
+		}
+	}
+	return msg, err
+}
+
+// Messages returns a channel on which every message read from the Stream is delivered, for consumers which prefer
+// channels to calling NextMessage in a loop. The channel is closed when ctx is done or reading fails; Err then reports
+// why. Messages must not be combined with other reads from the Stream.
+func (c *Stream) Messages(ctx context.Context) <-chan *Message {
+	ch := make(chan *Message)
+	go func() {
+		defer close(ch)
+		for {
+			msg, err := c.NextMessage(ctx)
+			if err != nil {
+				c.err.Store(&err)
+				return
+			}
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
+				err := ctx.Err()
+				c.err.Store(&err)
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Err returns the error which closed the channel returned by Messages. It returns nil if the channel was closed
+// because a Stream created with NewReader reached the end of its input or the server finished sending a requested
+// Range, or if the channel has not been closed.
+func (c *Stream) Err() error {
+	err := c.err.Load()
+	if err == nil || errors.Is(*err, io.EOF) || errors.Is(*err, ErrRangeComplete) {
+		return nil
+	}
+	return *err
+}
+
+// deliver records the PITR of a successfully read message and surfaces server error messages as errors.
+func (c *Stream) deliver(msg *Message, err error) (*Message, error) {
+	if err != nil {
+		return msg, err
+	}
+	if msg.PITR != "" {
+		c.pitr.Store(msg.PITR)
+	}
+	if em, ok := msg.Payload.(ErrorMessage); ok {
+		return msg, &em
+	}
+	return msg, nil
+}
+
+// readMessage reads and decodes the next message from the stream, skipping any which are filtered out on the client.
+func (c *Stream) readMessage() (*Message, error) {
+	for {
+		msg, err := c.readOneMessage()
+		if err == nil && c.filtered(msg) {
+			ReleaseMessage(msg)
+			continue
+		}
+		return msg, err
+	}
+}
+
+// filtered reports whether msg should be discarded according to the AltitudeFilter and ExcludeUpdateTypes sent with
+// InitWith.
+func (c *Stream) filtered(msg *Message) bool {
+	if c.altitude == nil && len(c.excluded) == 0 {
+		return false
+	}
+	var update UpdateType
+	switch m := msg.Payload.(type) {
+	case PositionMessage:
+		if c.altitude != nil {
+			if alt, ok := m.Altitude(); !ok || !c.altitude.Contains(alt) {
+				return true
+			}
+		}
+		update = m.UpdateType
+	case GroundPositionMessage:
+		update = m.UpdateType
+	case VehiclePositionMessage:
+		update = m.UpdateType
+	default:
+		return false
+	}
+	for _, u := range c.excluded {
+		if u == update {
+			return true
+		}
+	}
+	return false
+}
+
+// readOneMessage reads and decodes the next message from the stream.
+func (c *Stream) readOneMessage() (*Message, error) {
+	line, err := c.readLine()
+	if err != nil {
+		if c.ranged && errors.Is(err, io.EOF) {
+			c.opts.logger.Info("range complete")
+			return nil, ErrRangeComplete
+		}
+		switch {
+		case errors.Is(err, ErrMessageTooLarge):
+			c.opts.logger.Debug("skipped oversized message", "max_size", c.opts.maxMessageSize)
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			// An interrupted read is reported by the caller, which knows whether it was cancelled or timed out.
+		default:
+			c.opts.logger.Info("read failed", "error", err)
+		}
+		return nil, err
+	}
+	c.lastReceived = time.Now()
+	c.received.Store(c.lastReceived.UnixNano())
+	if c.tee != nil {
+		c.tee.write(line)
+	}
+	// The line is always a single JSON value, so it is decoded directly rather than through json.Unmarshal, which
+	// would scan it an extra time before calling UnmarshalJSON.
+	msg := newMessage()
+	if c.opts.rawMessages {
+		msg.Raw = append(json.RawMessage(nil), line...)
+	}
+	if err := msg.UnmarshalJSON(line); err != nil {
+		c.opts.logger.Debug("could not decode message", "type", msg.Type, "error", err)
+		return msg, err
+	}
+	c.stats.countMessage(msg.Type)
+	if _, ok := msg.Payload.(UnknownMessage); ok {
+		c.opts.logger.Debug("received message of unknown type", "type", msg.Type)
+	}
+	if err := c.process(msg); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+// process applies the Stream's configured processing to a freshly decoded message.
+func (c *Stream) process(msg *Message) error {
+	if c.opts.fieldValidator == nil && c.opts.enricher == nil && c.clocks == nil {
+		return nil
+	}
+	pos, ok := msg.Payload.(PositionMessage)
+	if !ok {
+		return nil
+	}
+	if c.clocks != nil && c.clocks.observe(pos) {
+		c.stats.clockRegressions.Add(1)
+	}
+	if c.opts.fieldValidator != nil {
+		validatePosition(pos, c.opts.fieldValidator)
+	}
+	if c.opts.enricher != nil {
+		err := c.opts.enricher.Enrich(&pos)
+		msg.Payload = pos
+		if err != nil {
+			return fmt.Errorf("could not enrich position: %w", err)
+		}
+	}
+	return nil
+}
+
+// readLine returns the next non-empty line from the stream, without its line terminator.
+//
+// If a line exceeds the maximum message size, it is discarded up to the next newline and ErrMessageTooLarge is
+// returned, leaving the stream positioned at the start of the following message.
+func (c *Stream) readLine() ([]byte, error) {
+	if c.reader == nil {
+		// Buffer the raw data so that small messages do not each cost a read from the connection. A decompressor which
+		// is given a bufio.Reader reads through it rather than adding a buffer of its own.
+		raw := bufio.NewReaderSize(countingReader{c.src, &c.stats.bytesRead}, c.opts.readBufferSize)
+		c.reader = raw
+		if c.opts.compression != CompressionNone {
+			src, err := decompress(raw, c.opts.compression)
+			if err != nil {
+				return nil, fmt.Errorf("could not start decompression: %w", err)
+			}
+			c.reader = bufio.NewReaderSize(src, c.opts.readBufferSize)
+		}
+	}
+
+	max := c.opts.maxMessageSize
+	for {
+		if !c.partial {
+			c.line = c.line[:0]
+			c.tooLarge = false
+		}
+		c.partial = true
+		for {
+			chunk, err := c.reader.ReadSlice('\n')
+			if !c.tooLarge {
+				// Allow for a CRLF terminator before deciding that the line cannot fit.
+				if len(c.line)+len(chunk) > max+2 {
+					c.tooLarge = true
+					c.line = c.line[:0]
+				} else {
+					c.line = append(c.line, chunk...)
+				}
+			}
+			if errors.Is(err, bufio.ErrBufferFull) {
+				continue
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					c.partial = false
+					if c.tooLarge {
+						return nil, ErrMessageTooLarge
+					}
+				}
+				// A final message without a trailing newline is still delivered; the next read reports the EOF.
+				// Otherwise, what has been read so far is kept so that the message can be completed by a later read.
+				if !errors.Is(err, io.EOF) || len(c.line) == 0 {
+					return nil, err
+				}
+			}
+			break
+		}
+		c.partial = false
+		if c.tooLarge {
+			return nil, ErrMessageTooLarge
+		}
+		line := bytes.TrimSpace(c.line)
+		if len(line) > max {
+			return nil, ErrMessageTooLarge
+		}
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+// Close closes the Firehose Stream and the underlying net.Conn. If WithTee was used, Close waits for the lines read so
+// far to be written and reports any error writing them. If WithBuffer was used, Close stops the background decoder and
+// discards any messages it has buffered.
+//
+// A call to NextMessage in progress is interrupted, and Close waits for it to return before closing the tee, so that
+// nothing is read or written after Close returns. A Stream created with NewReader can only be interrupted if its
+// reader is an io.Closer; otherwise Close does not wait. Once closed, NextMessage returns ErrStreamClosed.
+//
+// Close may be called more than once, and from any goroutine. Later calls return the same error as the first.
+func (c *Stream) Close() error {
+	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		c.buffer.once.Do(func() {})
+		var err error
+		interrupted := true
+		if c.conn == nil {
+			closer, ok := c.src.(io.Closer)
+			if ok {
+				err = closer.Close()
+			}
+			interrupted = ok
+		} else {
+			err = c.conn.Close()
+		}
+		c.buffer.stop()
+		if interrupted {
+			c.readMu.Lock()
+			c.readMu.Unlock()
+		}
+		if c.tee != nil {
+			err = errors.Join(err, c.tee.close())
+		}
+		c.closeErr = err
+	})
+	return c.closeErr
+}
+
+// decompress wraps r in a reader which undoes the given compression.
+//
+// The server only begins compressing once it has received the init command, and sends nothing before it, so the
+// decompressor can be applied from the first byte read from the connection.
+func decompress(r io.Reader, compression Compression) (io.Reader, error) {
+	switch compression {
+	case CompressionNone:
+		return r, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		// Without this, the reader would block at the end of the stream waiting for the header of a further member
+		// before returning the final data of the current one.
+		zr.Multistream(false)
+		return zr, nil
+	case CompressionCompress:
+		return zlib.NewReader(r)
+	case CompressionDeflate:
+		return flate.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+// parseEpoch parses a POSIX epoch timestamp as used throughout the Firehose protocol.
+func parseEpoch(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid epoch timestamp %q", s)
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), nil
 }
@@ -1,15 +1,26 @@
 package firehose_test
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/benburwell/firehose"
+	"github.com/benburwell/firehose/firehosetest"
 )
 
 var (
@@ -34,6 +45,28 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// pipeStream returns a Stream reading from one end of an in-memory connection, along with the other end of the
+// connection, which plays the part of the Firehose server.
+func pipeStream(t *testing.T, opts ...firehose.Option) (*firehose.Stream, net.Conn) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return firehose.NewStream(client, opts...), server
+}
+
+// serve writes each of the provided lines to conn in the background.
+func serve(conn net.Conn, lines ...string) {
+	go func() {
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(conn, line); err != nil {
+				return
+			}
+		}
+	}()
+}
+
 func TestConnect(t *testing.T) {
 	if !runIntegration {
 		t.Skip("Skipping integration tests")
@@ -75,6 +108,348 @@ func TestConnect(t *testing.T) {
 	}
 }
 
+func TestOpenStream(t *testing.T) {
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	srv := firehosetest.NewServer(`{"type":"keepalive","serverTime":"1"}`)
+	defer srv.Close()
+	stream, err := firehose.OpenStream(context.Background(), cmd, append(srv.Options(), firehose.WithInitTimeout(time.Second))...)
+	if err != nil {
+		t.Fatalf("could not open stream: %v", err)
+	}
+	defer stream.Close()
+	if inits := srv.Inits(); len(inits) != 1 || inits[0] != cmd.String() {
+		t.Errorf("unexpected init commands: %q", inits)
+	}
+	if msg, err := stream.NextMessage(context.Background()); err != nil || msg.Type != "keepalive" {
+		t.Errorf("expected the first message, got %v, %v", msg, err)
+	}
+}
+
+func TestOpenStreamCancelled(t *testing.T) {
+	// The server never responds, so OpenStream waits for the first message until ctx is cancelled, and must then close
+	// the connection.
+	closed := make(chan struct{})
+	srv := firehosetest.NewServerFunc(func(c *firehosetest.Conn) {
+		c.Read(make([]byte, 1))
+		close(closed)
+	})
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	_, err := firehose.OpenStream(ctx, cmd, append(srv.Options(), firehose.WithInitTimeout(time.Minute))...)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context's error, got: %v", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the connection was left open")
+	}
+}
+
+func TestConnectContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := firehose.ConnectContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	config := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	stream, err := firehose.Dial(context.Background(),
+		firehose.WithAddress(addr),
+		firehose.WithTLSConfig(config),
+		firehose.WithDialer(&net.Dialer{Timeout: time.Second}),
+	)
+	if err != nil {
+		t.Fatalf("could not dial test server: %v", err)
+	}
+	stream.Close()
+
+	if _, err := firehose.Dial(context.Background(), firehose.WithAddress(addr)); err == nil {
+		t.Errorf("expected certificate verification to fail without the test server's TLS config")
+	}
+}
+
+func TestDialLocalAddr(t *testing.T) {
+	// Any address on the loopback network can be bound on Linux, so a second one shows that the requested address is
+	// used rather than the one the operating system would choose.
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}
+	if l, err := net.ListenTCP("tcp", local); err != nil {
+		t.Skipf("cannot bind %s: %v", local.IP, err)
+	} else {
+		l.Close()
+	}
+
+	remotes := make(chan net.Addr, 1)
+	srv := firehosetest.NewServerFunc(func(c *firehosetest.Conn) {
+		remotes <- c.RemoteAddr()
+	})
+	defer srv.Close()
+	stream, err := firehose.Dial(context.Background(), append(srv.Options(), firehose.WithLocalAddr(local))...)
+	if err != nil {
+		t.Fatalf("could not dial test server: %v", err)
+	}
+	defer stream.Close()
+	if err := stream.Init("live"); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	if remote := (<-remotes).(*net.TCPAddr); !remote.IP.Equal(local.IP) {
+		t.Errorf("expected a connection from %s, got one from %s", local.IP, remote)
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	stream, err := firehose.Dial(context.Background(), firehose.WithAddress(addr), firehose.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatalf("could not dial test server without verification: %v", err)
+	}
+	stream.Close()
+
+	_, err = firehose.Dial(context.Background(),
+		firehose.WithAddress(addr),
+		firehose.WithInsecureSkipVerify(),
+		firehose.WithPinnedCertificate([]byte("some other certificate")),
+	)
+	if !errors.Is(err, firehose.ErrCertificateNotPinned) {
+		t.Errorf("expected pinning to be enforced without verification, got: %v", err)
+	}
+}
+
+func TestPinnedCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	config := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	stream, err := firehose.Dial(context.Background(),
+		firehose.WithAddress(addr),
+		firehose.WithTLSConfig(config),
+		firehose.WithPinnedCertificate([]byte("some other certificate")),
+		firehose.WithPinnedCertificate(srv.Certificate().Raw),
+	)
+	if err != nil {
+		t.Fatalf("could not dial test server with its certificate pinned: %v", err)
+	}
+	stream.Close()
+
+	_, err = firehose.Dial(context.Background(),
+		firehose.WithAddress(addr),
+		firehose.WithTLSConfig(config),
+		firehose.WithPinnedCertificate([]byte("some other certificate")),
+	)
+	if !errors.Is(err, firehose.ErrCertificateNotPinned) {
+		t.Errorf("expected ErrCertificateNotPinned, got: %v", err)
+	}
+	if config.VerifyPeerCertificate != nil {
+		t.Errorf("the supplied TLS config was modified")
+	}
+}
+
+func TestReadDeadlineCleared(t *testing.T) {
+	stream, server := pipeStream(t)
+	go func() {
+		fmt.Fprintln(server, `{"type":"keepalive","serverTime":"1"}`)
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintln(server, `{"type":"keepalive","serverTime":"2"}`)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := stream.NextMessage(ctx); err != nil {
+		t.Fatalf("unexpected error reading first message: %v", err)
+	}
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("deadline from previous call leaked into the next one: %v", err)
+	}
+	if km := msg.Payload.(firehose.KeepaliveMessage); km.ServerTime != "2" {
+		t.Errorf("unexpected second message: %#v", km)
+	}
+}
+
+func TestCancelledReadKeepsStreamOpen(t *testing.T) {
+	stream, server := pipeStream(t)
+	resume := make(chan struct{})
+	go func() {
+		fmt.Fprint(server, `{"type":"keepalive",`)
+		<-resume
+		fmt.Fprintln(server, `"serverTime":"1"}`)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := stream.NextMessage(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := stream.NextMessage(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+
+	close(resume)
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error after cancelled reads: %v", err)
+	}
+	if km := msg.Payload.(firehose.KeepaliveMessage); km.ServerTime != "1" {
+		t.Errorf("message interrupted by cancellation was not completed: %#v", km)
+	}
+}
+
+func TestCancelledReadsDoNotLeakGoroutines(t *testing.T) {
+	stream, server := pipeStream(t)
+	before := runtime.NumGoroutine()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 100; i++ {
+		if _, err := stream.NextMessage(cancelled); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		_, err := stream.NextMessage(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+		}
+	}
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			fmt.Fprintln(server, `{"type":"keepalive","serverTime":"1"}`)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := stream.NextMessage(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Allow goroutines which have finished their work a moment to exit.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines grew from %d to %d", before, after)
+	}
+}
+
+func TestConcurrentRead(t *testing.T) {
+	stream, server := pipeStream(t)
+	first := make(chan error, 1)
+	go func() {
+		for {
+			_, err := stream.NextMessage(context.Background())
+			if !errors.Is(err, firehose.ErrConcurrentRead) {
+				first <- err
+				return
+			}
+			runtime.Gosched()
+		}
+	}()
+
+	// Wait for the goroutine's call to block reading from the connection. Until it does, a call here may itself become
+	// the reader, so it must give up quickly.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := stream.NextMessage(ctx)
+		cancel()
+		if errors.Is(err, firehose.ErrConcurrentRead) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected ErrConcurrentRead, got: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	serve(server, `{"type":"keepalive","serverTime":"1"}`)
+	if err := <-first; err != nil {
+		t.Fatalf("the call in progress was disturbed by the concurrent call: %v", err)
+	}
+}
+
+func TestCloseDuringRead(t *testing.T) {
+	for name, opts := range map[string][]firehose.Option{
+		"unbuffered": nil,
+		"buffered":   {firehose.WithBuffer(4)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stream, _ := pipeStream(t, opts...)
+			read := make(chan error, 1)
+			go func() {
+				_, err := stream.NextMessage(context.Background())
+				read <- err
+			}()
+
+			time.Sleep(10 * time.Millisecond)
+			if err := stream.Close(); err != nil {
+				t.Fatalf("could not close: %v", err)
+			}
+			select {
+			case err := <-read:
+				if !errors.Is(err, firehose.ErrStreamClosed) {
+					t.Errorf("expected ErrStreamClosed from the interrupted read, got: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("the read in progress was not interrupted by Close")
+			}
+
+			if err := stream.Close(); err != nil {
+				t.Errorf("expected closing again to succeed, got: %v", err)
+			}
+			if _, err := stream.NextMessage(context.Background()); !errors.Is(err, firehose.ErrStreamClosed) {
+				t.Errorf("expected ErrStreamClosed after Close, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	stream, server := pipeStream(t, firehose.WithReadTimeout(50*time.Millisecond))
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		fmt.Fprintln(server, `{"type":"keepalive","serverTime":"1"}`)
+	}()
+
+	if _, err := stream.NextMessage(context.Background()); !errors.Is(err, firehose.ErrReadTimeout) {
+		t.Fatalf("expected ErrReadTimeout, got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := stream.NextMessage(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the earlier context deadline to apply, got: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := stream.NextMessage(context.Background()); err != nil {
+		t.Errorf("unexpected error once data arrived: %v", err)
+	}
+}
+
 func TestUnmarshalError(t *testing.T) {
 	data := []byte(`{"type":"error","error_msg":"I am an error"}`)
 	var msg firehose.Message
@@ -117,6 +492,140 @@ func TestUnmarshalPosition(t *testing.T) {
 	}
 }
 
+func TestUnmarshalBlockedPosition(t *testing.T) {
+	// A privacy-blocked flight carries no marker, and its identifying fields may be empty or missing altogether.
+	for _, data := range []string{
+		`{"type":"position","id":"X-1596063797-adhoc-0","clock":"1596067217","lat":"9.01767","lon":"-79.42058"}`,
+		`{"type":"position","id":"X-1596063797-adhoc-0","clock":"1596067217","lat":"9.01767","lon":"-79.42058",` +
+			`"ident":"","atcident":"","reg":"","orig":"","dest":"","squawk":""}`,
+	} {
+		var msg firehose.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		pm, ok := msg.Payload.(firehose.PositionMessage)
+		if !ok {
+			t.Fatalf("payload is not a position message: %T", msg.Payload)
+		}
+		if id := pm.Identity(); id != (firehose.Identity{}) || pm.DisplayName() != "" {
+			t.Errorf("expected no identity, got: %+v", id)
+		}
+		if orig, ok := pm.Origin(); ok {
+			t.Errorf("expected no origin, got: %+v", orig)
+		}
+		if dest, ok := pm.Destination(); ok {
+			t.Errorf("expected no destination, got: %+v", dest)
+		}
+		if code, ok := pm.SquawkCode(); ok {
+			t.Errorf("expected no squawk code, got: %s", code)
+		}
+		if pm.Latitude() != 9.01767 || pm.Longitude() != -79.42058 {
+			t.Errorf("expected the position to decode, got: %v, %v", pm.Latitude(), pm.Longitude())
+		}
+	}
+}
+
+func TestUnmarshalKeepalive(t *testing.T) {
+	data := []byte(`{"type":"keepalive","serverTime":"1596067223","pitr":"1596067220"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Errorf("unmarshal error: %v", err)
+	}
+	km, ok := msg.Payload.(firehose.KeepaliveMessage)
+	if !ok {
+		t.Fatalf("payload is not a keepalive message: %t", msg.Payload)
+	}
+	if km.ServerTime != "1596067223" || km.PITR != "1596067220" {
+		t.Errorf("unexpected keepalive message: %#v", km)
+	}
+	if msg.PITR != "1596067220" {
+		t.Errorf("unexpected message PITR: %s", msg.PITR)
+	}
+}
+
+func TestUnmarshalUnknown(t *testing.T) {
+	data := []byte(`{"type":"something_new","ident":"WSN145"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unknown message types should not fail to unmarshal: %v", err)
+	}
+	if msg.Type != "something_new" {
+		t.Errorf("unexpected type: %s", msg.Type)
+	}
+	um, ok := msg.Payload.(firehose.UnknownMessage)
+	if !ok {
+		t.Fatalf("payload is not an unknown message: %t", msg.Payload)
+	}
+	if um.Type != "something_new" || string(um.Raw) != string(data) {
+		t.Errorf("unexpected unknown message: %#v", um)
+	}
+}
+
+func TestMarshalMessage(t *testing.T) {
+	for _, data := range []string{
+		`{"pitr":"1596067223","type":"position","ident":"WSN145","air_ground":"A","alt":"1550","clock":"1596067217","id":"WSN145-1596063797-adhoc-0","gs":"124","lat":"9.01767","lon":"-79.42058","orig":"L 9.13179 -81.43443","updateType":"A","waypoints":[{"lat":9.1,"lon":-81.4}]}`,
+		`{"type":"error","error_msg":"I am an error"}`,
+		`{"type":"something_new","ident":"WSN145"}`,
+	} {
+		var msg firehose.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		out, err := json.Marshal(&msg)
+		if err != nil {
+			t.Fatalf("marshal error: %v", err)
+		}
+		var again firehose.Message
+		if err := json.Unmarshal(out, &again); err != nil {
+			t.Fatalf("could not unmarshal %s: %v", out, err)
+		}
+		if !reflect.DeepEqual(msg, again) {
+			t.Errorf("message did not survive a round trip through %s:\n%#v\n%#v", out, msg, again)
+		}
+	}
+
+	// A payload built by hand need not set its Type.
+	out, err := json.Marshal(firehose.Message{Type: "error", Payload: firehose.ErrorMessage{ErrorMessage: "oops"}})
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	var msg firehose.Message
+	if err := json.Unmarshal(out, &msg); err != nil {
+		t.Fatalf("could not unmarshal %s: %v", out, err)
+	}
+	if em, ok := msg.Payload.(firehose.ErrorMessage); !ok || em.ErrorMessage != "oops" {
+		t.Errorf("unexpected message from %s: %#v", out, msg)
+	}
+}
+
+func TestRawMessages(t *testing.T) {
+	lines := []string{
+		`{"type":"position", "ident":"A1", "alt":12000}`,
+		`{"type":"keepalive","serverTime":"1"}`,
+	}
+	data := strings.Join(lines, "\r\n") + "\r\n"
+
+	stream := firehose.NewReader(strings.NewReader(data), firehose.WithRawMessages())
+	for _, line := range lines {
+		msg, err := stream.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(msg.Raw) != line {
+			t.Errorf("expected raw message %s, got %s", line, msg.Raw)
+		}
+	}
+
+	stream = firehose.NewReader(strings.NewReader(data))
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Raw != nil {
+		t.Errorf("expected no raw message without WithRawMessages, got %s", msg.Raw)
+	}
+}
+
 func TestInitCommand(t *testing.T) {
 	c := firehose.InitCommand{
 		Live: true,
@@ -125,18 +634,785 @@ func TestInitCommand(t *testing.T) {
 			Start: "2",
 			End:   "3",
 		},
-		Password:      "pw",
-		Username:      "un",
-		AirportFilter: []string{"KBOS", "EG??"},
-		Events:        []firehose.Event{firehose.PositionEvent},
+		Password:           "pw",
+		Username:           "un",
+		AirportFilter:      []string{"KBOS", "EG??"},
+		AirlineFilter:      []string{"UAL", "DAL"},
+		IdentFilter:        []string{"N12*"},
+		AircraftTypeFilter: []string{"B77W", "B789"},
+		Events:             []firehose.Event{firehose.PositionEvent},
 		LatLong: []firehose.Rectangle{
 			{LowLat: 1, LowLon: 2, HiLat: 3, HiLon: 4},
 			{LowLat: 5, LowLon: 6, HiLat: 7, HiLon: 8},
 		},
+		Keepalive:      30 * time.Second,
+		Version:        "26.0",
+		RawArgs:        []string{"new_filter", `"a b"`},
+		AltitudeFilter: &firehose.AltitudeRange{Min: 30000},
+	}
+	actual := c.String()
+	expected := `live pitr 1 range 2 3 username "un" password "pw" airport_filter "KBOS EG??" airline_filter "UAL DAL" ident_filter "N12*" type_filter "B77W B789" events "position" latlong "1.000000 2.000000 3.000000 4.000000" latlong "5.000000 6.000000 7.000000 8.000000" keepalive 30 version 26.0 new_filter "a b"`
+	if actual != expected {
+		t.Errorf("unexpected init command: %s", actual)
+	}
+	if err := c.Validate(); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand for conflicting time modes, got: %v", err)
 	}
+}
+
+func TestAltitudeFilter(t *testing.T) {
+	stream, server := pipeStream(t)
+	go func() {
+		bufio.NewReader(server).ReadString('\n')
+		fmt.Fprintln(server, `{"type":"position","ident":"LOW","alt":"12000"}`)
+		fmt.Fprintln(server, `{"type":"position","ident":"NONE"}`)
+		fmt.Fprintln(server, `{"type":"flightplan","ident":"FP"}`)
+		fmt.Fprintln(server, `{"type":"position","ident":"HIGH","alt":"37000"}`)
+	}()
+
+	cmd := firehose.InitCommand{
+		Live:           true,
+		Username:       "un",
+		Password:       "pw",
+		AltitudeFilter: &firehose.AltitudeRange{Min: 30000},
+	}
+	if err := stream.InitWith(context.Background(), cmd); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	for _, want := range []string{"flightplan", "position"} {
+		msg, err := stream.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if msg.Type != want {
+			t.Errorf("expected %s message, got %s", want, msg.Type)
+		}
+		if pos, ok := msg.Payload.(firehose.PositionMessage); ok && pos.Ident != "HIGH" {
+			t.Errorf("position outside the altitude filter was returned: %s", pos.Ident)
+		}
+	}
+
+	if !(firehose.AltitudeRange{Min: 100, Max: 200}).Contains(200) || (firehose.AltitudeRange{Min: 100, Max: 200}).Contains(201) {
+		t.Errorf("unexpected bounds for altitude range")
+	}
+	cmd.AltitudeFilter = &firehose.AltitudeRange{Min: 200, Max: 100}
+	if err := cmd.Validate(); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand for inverted altitude filter, got: %v", err)
+	}
+}
+
+func TestAltitudeFilterNotSent(t *testing.T) {
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	unfiltered := cmd.String()
+	cmd.AltitudeFilter = &firehose.AltitudeRange{Min: 30000}
+	if actual := cmd.String(); actual != unfiltered {
+		t.Errorf("expected the altitude filter to be left out of the command, got: %s", actual)
+	}
+
+	// Sent as a string, the command carries no filter, so every position is returned.
+	stream, server := pipeStream(t)
+	go func() {
+		bufio.NewReader(server).ReadString('\n')
+		fmt.Fprintln(server, `{"type":"position","ident":"LOW","alt":"12000"}`)
+	}()
+	if err := stream.Init(cmd.String()); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pos := msg.Payload.(firehose.PositionMessage); pos.Ident != "LOW" {
+		t.Errorf("unexpected position: %s", pos.Ident)
+	}
+}
+
+func TestExcludeUpdateTypes(t *testing.T) {
+	stream, server := pipeStream(t)
+	go func() {
+		bufio.NewReader(server).ReadString('\n')
+		fmt.Fprintln(server, `{"type":"position","ident":"EST","updateType":"P"}`)
+		fmt.Fprintln(server, `{"type":"ground_position","id":"GND-EST","updateType":"P"}`)
+		fmt.Fprintln(server, `{"type":"flightplan","ident":"FP"}`)
+		fmt.Fprintln(server, `{"type":"position","ident":"ADSB","updateType":"A"}`)
+	}()
+
+	cmd := firehose.InitCommand{
+		Live:               true,
+		Username:           "un",
+		Password:           "pw",
+		ExcludeUpdateTypes: []firehose.UpdateType{firehose.UpdateTypeEstimated},
+	}
+	if err := stream.InitWith(context.Background(), cmd); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	unfiltered := cmd
+	unfiltered.ExcludeUpdateTypes = nil
+	if cmd.String() != unfiltered.String() {
+		t.Errorf("expected update types not to be sent to the server: %s", cmd.String())
+	}
+	for _, want := range []string{"flightplan", "position"} {
+		msg, err := stream.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if msg.Type != want {
+			t.Errorf("expected %s message, got %s", want, msg.Type)
+		}
+		if pos, ok := msg.Payload.(firehose.PositionMessage); ok && pos.Ident != "ADSB" {
+			t.Errorf("excluded position was returned: %s", pos.Ident)
+		}
+	}
+}
+
+func TestInitCommandQuoting(t *testing.T) {
+	c := firehose.InitCommand{Live: true, Username: "my user", Password: "p\"w\\d\nlive"}
 	actual := c.String()
-	expected := `live pitr 1 range 2 3 username un password pw airport_filter "KBOS EG??" events "position" latlong "1.000000 2.000000 3.000000 4.000000" latlong "5.000000 6.000000 7.000000 8.000000"`
+	expected := `live username "my user" password "p\"w\\d\nlive"`
 	if actual != expected {
 		t.Errorf("unexpected init command: %s", actual)
 	}
+	if strings.ContainsAny(actual, "\r\n") {
+		t.Errorf("init command contains a line break: %q", actual)
+	}
+}
+
+func TestInitCommandKeepalive(t *testing.T) {
+	for keepalive, want := range map[time.Duration]string{
+		500 * time.Millisecond:  "keepalive 1",
+		time.Second:             "keepalive 1",
+		1500 * time.Millisecond: "keepalive 2",
+		time.Minute:             "keepalive 60",
+	} {
+		c := firehose.InitCommand{Live: true, Keepalive: keepalive}
+		if actual := c.String(); !strings.HasSuffix(actual, " "+want) {
+			t.Errorf("expected %q for a keepalive of %s, got: %s", want, keepalive, actual)
+		}
+	}
+}
+
+func TestInitRejectsLineBreaks(t *testing.T) {
+	stream, _ := pipeStream(t)
+	for _, command := range []string{"live username un password pw\nlive", "live username un password pw\r"} {
+		if err := stream.Init(command); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+			t.Errorf("expected ErrInvalidInitCommand for %q, got: %v", command, err)
+		}
+	}
+}
+
+func TestInitCommandValidate(t *testing.T) {
+	c := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	if err := c.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+
+	c.Password = ""
+	if err := c.Validate(); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand for missing password, got: %v", err)
+	}
+
+	c = firehose.InitCommand{Live: true, Password: "pw"}
+	if err := c.Validate(); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand for missing username, got: %v", err)
+	}
+
+	c = firehose.InitCommand{Live: true, Username: "un", Password: "pw", Version: "26.0 events"}
+	if err := c.Validate(); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand for a version with spaces, got: %v", err)
+	}
+
+	for _, c := range []firehose.InitCommand{
+		{Username: "un", Password: "pw"},
+		{Live: true, PITR: "1", Username: "un", Password: "pw"},
+		{PITR: "1", Range: &firehose.PITRRange{Start: "1", End: "2"}, Username: "un", Password: "pw"},
+	} {
+		if err := c.Validate(); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+			t.Errorf("expected ErrInvalidInitCommand for time modes of %s, got: %v", c.Redacted(), err)
+		}
+	}
+	c = firehose.InitCommand{Range: &firehose.PITRRange{Start: "1", End: "2"}, Username: "un", Password: "pw"}
+	if err := c.Validate(); err != nil {
+		t.Errorf("unexpected validation error for range: %v", err)
+	}
+}
+
+func TestCredentialsFromEnv(t *testing.T) {
+	t.Setenv("FIREHOSE_USERNAME", "")
+	t.Setenv("FIREHOSE_PASSWORD", "secret")
+	if _, _, ok := firehose.CredentialsFromEnv(); ok {
+		t.Errorf("expected ok to be false without a username")
+	}
+
+	t.Setenv("FIREHOSE_USERNAME", "user")
+	user, pass, ok := firehose.CredentialsFromEnv()
+	if !ok || user != "user" || pass != "secret" {
+		t.Errorf("got (%q, %q, %v), want (\"user\", \"secret\", true)", user, pass, ok)
+	}
+}
+
+func TestNewPITRRange(t *testing.T) {
+	start := time.Unix(1596067800, 500)
+	if pitr := firehose.PITRFromTime(start); pitr != "1596067800" {
+		t.Errorf("unexpected PITR: %s", pitr)
+	}
+
+	r, err := firehose.NewPITRRange(start, start.Add(6*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Start != "1596067800" || r.End != "1596089400" {
+		t.Errorf("unexpected range: %+v", r)
+	}
+
+	for _, end := range []time.Time{start, start.Add(-time.Hour), start.Add(time.Millisecond)} {
+		if _, err := firehose.NewPITRRange(start, end); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+			t.Errorf("expected ErrInvalidInitCommand for end %v, got: %v", end, err)
+		}
+	}
+}
+
+func TestInitCommandRedacted(t *testing.T) {
+	c := firehose.InitCommand{Live: true, Username: "un", Password: "secret"}
+	actual := c.Redacted()
+	if strings.Contains(actual, "secret") {
+		t.Errorf("password leaked into redacted command: %s", actual)
+	}
+	expected := `live username "un" password "REDACTED"`
+	if actual != expected {
+		t.Errorf("unexpected redacted command: %s", actual)
+	}
+	if c.Password != "secret" {
+		t.Errorf("Redacted modified the command")
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	stream, server := pipeStream(t, firehose.WithMaxMessageSize(64))
+	oversized := `{"type":"keepalive","serverTime":"` + strings.Repeat("1", 100) + `"}`
+	serve(server, oversized, `{"type":"keepalive","serverTime":"1596067800"}`)
+
+	if _, err := stream.NextMessage(context.Background()); !errors.Is(err, firehose.ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got: %v", err)
+	}
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error reading message after oversized one: %v", err)
+	}
+	if km := msg.Payload.(firehose.KeepaliveMessage); km.ServerTime != "1596067800" {
+		t.Errorf("unexpected message after oversized one: %#v", km)
+	}
+}
+
+func TestUnmarshalFlightPlan(t *testing.T) {
+	data := []byte(`{"type":"flightplan","ident":"UAL123","id":"UAL123-1596000000-airline-0001","status":"F","aircrafttype":"B739","alt":"35000","speed":"450","orig":"KBOS","dest":"KSFO","fdt":"1596067200","edt":"1596067800","eta":"1596090000","ete":"22200","route":"SSOXS6 BUZRD DCT","waypoints":[{"lat":42.36,"lon":-71.01},{"lat":37.62,"lon":-122.38}],"pitr":"1596060000"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	fp, ok := msg.Payload.(firehose.FlightPlanMessage)
+	if !ok {
+		t.Fatalf("payload is not a flight plan message: %t", msg.Payload)
+	}
+	if fp.Ident != "UAL123" || fp.Orig != "KBOS" || fp.Dest != "KSFO" || fp.Route != "SSOXS6 BUZRD DCT" {
+		t.Errorf("unexpected flight plan: %#v", fp)
+	}
+	if len(fp.Waypoints) != 2 || fp.Waypoints[1].Lon != -122.38 {
+		t.Errorf("unexpected waypoints: %#v", fp.Waypoints)
+	}
+}
+
+func TestUnmarshalDepartureArrival(t *testing.T) {
+	data := []byte(`{"type":"departure","ident":"UAL123","id":"UAL123-1","aircrafttype":"B739","orig":"KBOS","dest":"KSFO","adt":"1596067800","synthetic":"1","pitr":"1596067801"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	dm, ok := msg.Payload.(firehose.DepartureMessage)
+	if !ok {
+		t.Fatalf("payload is not a departure message: %t", msg.Payload)
+	}
+	if dm.Orig != "KBOS" || dm.ADT != "1596067800" || dm.Synthetic != "1" {
+		t.Errorf("unexpected departure: %#v", dm)
+	}
+
+	data = []byte(`{"type":"arrival","ident":"UAL123","id":"UAL123-1","orig":"KBOS","dest":"KSFO","aat":"1596090000","pitr":"1596090001"}`)
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	am, ok := msg.Payload.(firehose.ArrivalMessage)
+	if !ok {
+		t.Fatalf("payload is not an arrival message: %t", msg.Payload)
+	}
+	if am.Dest != "KSFO" || am.AAT != "1596090000" || am.Synthetic != "" {
+		t.Errorf("unexpected arrival: %#v", am)
+	}
+}
+
+func TestUnmarshalCancellation(t *testing.T) {
+	data := []byte(`{"type":"cancellation","ident":"UAL123","id":"UAL123-1","orig":"KBOS","dest":"KSFO","trueCancel":"1","pitr":"1596067801"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	cm, ok := msg.Payload.(firehose.CancellationMessage)
+	if !ok {
+		t.Fatalf("payload is not a cancellation message: %t", msg.Payload)
+	}
+	if cm.ID != "UAL123-1" || cm.TrueCancel != "1" || msg.PITR != "1596067801" {
+		t.Errorf("unexpected cancellation: %#v", cm)
+	}
+}
+
+func TestRectangleValidate(t *testing.T) {
+	valid := firehose.Rectangle{LowLat: 40, LowLon: -75, HiLat: 45, HiLon: -70}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	for _, r := range []firehose.Rectangle{
+		{LowLat: -91, LowLon: 0, HiLat: 0, HiLon: 1},
+		{LowLat: 0, LowLon: 0, HiLat: 1, HiLon: 181},
+		{LowLat: 45, LowLon: -75, HiLat: 40, HiLon: -70},
+		{LowLat: 40, LowLon: 170, HiLat: 45, HiLon: -170},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected validation error for %v", r)
+		}
+	}
+
+	c := firehose.InitCommand{Live: true, Username: "un", Password: "pw", LatLong: []firehose.Rectangle{{LowLat: 45, HiLat: 40}}}
+	if err := c.Validate(); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand for invalid rectangle, got: %v", err)
+	}
+}
+
+func TestRectangleContains(t *testing.T) {
+	r := firehose.Rectangle{LowLat: 40, LowLon: -75, HiLat: 45, HiLon: -70}
+	if !r.Contains(42, -71) || !r.Contains(40, -75) {
+		t.Errorf("expected point to be contained")
+	}
+	if r.Contains(46, -71) || r.Contains(42, -76) {
+		t.Errorf("expected point not to be contained")
+	}
+
+	pacific := firehose.Rectangle{LowLat: -10, LowLon: 170, HiLat: 10, HiLon: -170}
+	if !pacific.Contains(0, 175) || !pacific.Contains(0, -175) || !pacific.Contains(0, 180) {
+		t.Errorf("expected point across the antimeridian to be contained")
+	}
+	if pacific.Contains(0, 0) {
+		t.Errorf("expected point outside wrapping rectangle not to be contained")
+	}
+}
+
+func TestRectangleSplit(t *testing.T) {
+	r := firehose.Rectangle{LowLat: 40, LowLon: -75, HiLat: 45, HiLon: -70}
+	if split := r.Split(); len(split) != 1 || split[0] != r {
+		t.Errorf("expected normal rectangle to be returned unchanged, got: %v", split)
+	}
+
+	pacific := firehose.Rectangle{LowLat: -10, LowLon: 170, HiLat: 10, HiLon: -170}
+	split := pacific.Split()
+	expected := []firehose.Rectangle{
+		{LowLat: -10, LowLon: 170, HiLat: 10, HiLon: 180},
+		{LowLat: -10, LowLon: -180, HiLat: 10, HiLon: -170},
+	}
+	if len(split) != 2 || split[0] != expected[0] || split[1] != expected[1] {
+		t.Fatalf("unexpected split: %v", split)
+	}
+	for _, r := range split {
+		if err := r.Validate(); err != nil {
+			t.Errorf("split produced invalid rectangle: %v", err)
+		}
+	}
+
+	c := firehose.InitCommand{Live: true, Username: "un", Password: "pw", LatLong: []firehose.Rectangle{pacific}}
+	if err := c.Validate(); err != nil {
+		t.Errorf("unexpected validation error for wrapping rectangle: %v", err)
+	}
+	want := `latlong "-10.000000 170.000000 10.000000 180.000000" latlong "-10.000000 -180.000000 10.000000 -170.000000"`
+	if actual := c.String(); !strings.HasSuffix(actual, want) {
+		t.Errorf("expected wrapping rectangle to be split, got: %s", actual)
+	}
+}
+
+func TestMergeRectangles(t *testing.T) {
+	for name, tc := range map[string]struct {
+		in, want []firehose.Rectangle
+	}{
+		"contained": {
+			in:   []firehose.Rectangle{{LowLat: 41, LowLon: -72, HiLat: 42, HiLon: -71}, {LowLat: 40, LowLon: -75, HiLat: 45, HiLon: -70}},
+			want: []firehose.Rectangle{{LowLat: 40, LowLon: -75, HiLat: 45, HiLon: -70}},
+		},
+		"overlapping": {
+			in:   []firehose.Rectangle{{LowLat: 40, LowLon: -75, HiLat: 45, HiLon: -70}, {LowLat: 40, LowLon: -72, HiLat: 45, HiLon: -65}},
+			want: []firehose.Rectangle{{LowLat: 40, LowLon: -75, HiLat: 45, HiLon: -65}},
+		},
+		"tiled": {
+			in: []firehose.Rectangle{
+				{LowLat: 0, LowLon: 0, HiLat: 1, HiLon: 1}, {LowLat: 0, LowLon: 1, HiLat: 1, HiLon: 2},
+				{LowLat: 1, LowLon: 0, HiLat: 2, HiLon: 1}, {LowLat: 1, LowLon: 1, HiLat: 2, HiLon: 2},
+			},
+			want: []firehose.Rectangle{{LowLat: 0, LowLon: 0, HiLat: 2, HiLon: 2}},
+		},
+		"disjoint": {
+			in:   []firehose.Rectangle{{LowLat: 0, LowLon: 0, HiLat: 1, HiLon: 1}, {LowLat: 0, LowLon: 2, HiLat: 1, HiLon: 3}, {LowLat: 0.5, LowLon: 0.5, HiLat: 1.5, HiLon: 1.5}},
+			want: []firehose.Rectangle{{LowLat: 0, LowLon: 0, HiLat: 1, HiLon: 1}, {LowLat: 0, LowLon: 2, HiLat: 1, HiLon: 3}, {LowLat: 0.5, LowLon: 0.5, HiLat: 1.5, HiLon: 1.5}},
+		},
+		"antimeridian": {
+			in:   []firehose.Rectangle{{LowLat: -10, LowLon: 170, HiLat: 10, HiLon: -170}, {LowLat: -5, LowLon: 175, HiLat: 5, HiLon: 178}},
+			want: []firehose.Rectangle{{LowLat: -10, LowLon: 170, HiLat: 10, HiLon: 180}, {LowLat: -10, LowLon: -180, HiLat: 10, HiLon: -170}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := firehose.MergeRectangles(tc.in)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+			// The merged set must cover exactly the points covered by the originals.
+			inAny := func(rects []firehose.Rectangle, lat, lon float64) bool {
+				for _, r := range rects {
+					if r.Contains(lat, lon) {
+						return true
+					}
+				}
+				return false
+			}
+			for lat := -12.0; lat <= 12; lat += 0.25 {
+				for lon := -180.0; lon <= 180; lon += 0.25 {
+					if inAny(tc.in, lat, lon) != inAny(got, lat, lon) {
+						t.Fatalf("coverage differs at %v, %v", lat, lon)
+					}
+				}
+			}
+		})
+	}
+
+	c := firehose.InitCommand{Live: true, Username: "un", Password: "pw", MergeLatLong: true, LatLong: []firehose.Rectangle{
+		{LowLat: 40, LowLon: -75, HiLat: 45, HiLon: -70}, {LowLat: 41, LowLon: -72, HiLat: 42, HiLon: -71},
+	}}
+	if actual, want := c.String(), `latlong "40.000000 -75.000000 45.000000 -70.000000"`; !strings.HasSuffix(actual, want) {
+		t.Errorf("expected merged rectangles to be sent, got: %s", actual)
+	}
+}
+
+func TestUnmarshalGroundPosition(t *testing.T) {
+	data := []byte(`{"type":"ground_position","ident":"UAL123","id":"UAL123-1","airport":"KSFO","lat":"37.6188","lon":"-122.3754","clock":"1596090300","groundspeed":"12","heading":"284","updateType":"X","air_ground":"G","pitr":"1596090301"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	gp, ok := msg.Payload.(firehose.GroundPositionMessage)
+	if !ok {
+		t.Fatalf("payload is not a ground position message: %t", msg.Payload)
+	}
+	if gp.Airport != "KSFO" || gp.GroundSpeed != "12" || gp.UpdateType != firehose.UpdateTypeASDEX || msg.PITR != "1596090301" {
+		t.Errorf("unexpected ground position: %#v", gp)
+	}
+}
+
+func TestUnmarshalFmsWx(t *testing.T) {
+	data := []byte(`{"type":"fmswx","ident":"UAL123","id":"UAL123-1","clock":"1596070000","observations":[{"name":"BUZRD","lat":42.1,"lon":-75.2,"alt":"35000","wind":{"direction":"270","speed":"85"},"temperature":"-52"}],"pitr":"1596070001"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	wx, ok := msg.Payload.(firehose.FmsWxMessage)
+	if !ok {
+		t.Fatalf("payload is not an fmswx message: %t", msg.Payload)
+	}
+	if len(wx.Observations) != 1 {
+		t.Fatalf("unexpected observations: %#v", wx.Observations)
+	}
+	if obs := wx.Observations[0]; obs.Name != "BUZRD" || obs.Wind.Speed != "85" || obs.Temperature != "-52" || obs.Lon != -75.2 {
+		t.Errorf("unexpected observation: %#v", obs)
+	}
+}
+
+func TestUnmarshalExtendedFlightInfo(t *testing.T) {
+	data := []byte(`{"type":"extendedFlightInfo","ident":"UAL123","id":"UAL123-1","orig":"KBOS","dest":"KSFO","scheduled_out":"1596067200","gate_orig":"B12","terminal_dest":"3","baggage_claim":"7","codeshares":["ACA5123","DLH7890"],"pitr":"1596060000"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	info, ok := msg.Payload.(firehose.ExtendedFlightInfoMessage)
+	if !ok {
+		t.Fatalf("payload is not an extended flight info message: %t", msg.Payload)
+	}
+	if info.GateOrig != "B12" || info.TerminalDest != "3" || info.BaggageClaim != "7" || info.ScheduledOut != "1596067200" {
+		t.Errorf("unexpected extended flight info: %#v", info)
+	}
+	if len(info.Codeshares) != 2 || info.Codeshares[1] != "DLH7890" {
+		t.Errorf("unexpected codeshares: %#v", info.Codeshares)
+	}
+}
+
+func TestUnmarshalVehiclePosition(t *testing.T) {
+	data := []byte(`{"type":"vehicleposition","id":"KBOS-PLOW7","vehicle_type":"snowplow","airport":"KBOS","lat":"42.3656","lon":"-71.0096","clock":"1596090300","groundspeed":"15","heading":"90","pitr":"1596090301"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	vp, ok := msg.Payload.(firehose.VehiclePositionMessage)
+	if !ok {
+		t.Fatalf("payload is not a vehicle position message: %t", msg.Payload)
+	}
+	if vp.VehicleType != "snowplow" || vp.Airport != "KBOS" || vp.GroundSpeed != "15" || msg.PITR != "1596090301" {
+		t.Errorf("unexpected vehicle position: %#v", vp)
+	}
+}
+
+func TestRangeComplete(t *testing.T) {
+	for _, tc := range []struct {
+		cmd  firehose.InitCommand
+		want error
+	}{
+		{firehose.InitCommand{Range: &firehose.PITRRange{Start: "1", End: "2"}, Username: "un", Password: "pw"}, firehose.ErrRangeComplete},
+		{firehose.InitCommand{Live: true, Username: "un", Password: "pw"}, io.EOF},
+	} {
+		stream, server := pipeStream(t)
+		go func() {
+			defer server.Close()
+			if _, err := bufio.NewReader(server).ReadString('\n'); err != nil {
+				return
+			}
+			fmt.Fprintln(server, `{"type":"keepalive","pitr":"2"}`)
+		}()
+		if err := stream.InitWith(context.Background(), tc.cmd); err != nil {
+			t.Fatalf("could not send init command: %v", err)
+		}
+		if _, err := stream.NextMessage(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err := stream.NextMessage(context.Background())
+		if !errors.Is(err, tc.want) {
+			t.Errorf("expected %v after %s, got: %v", tc.want, tc.cmd.Redacted(), err)
+		}
+		if tc.want == io.EOF && errors.Is(err, firehose.ErrRangeComplete) {
+			t.Errorf("live stream reported range completion")
+		}
+	}
+}
+
+func TestInitWith(t *testing.T) {
+	stream, server := pipeStream(t)
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	received := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(server).ReadString('\n')
+		received <- line
+	}()
+	if err := stream.InitWith(context.Background(), cmd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if line := <-received; line != cmd.String()+"\n" {
+		t.Errorf("unexpected init command sent: %q", line)
+	}
+
+	if err := stream.InitWith(context.Background(), firehose.InitCommand{Live: true}); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand for invalid command, got: %v", err)
+	}
+
+	// Nothing reads from the server end now, so the write blocks until the context expires.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := stream.InitWith(ctx, cmd); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestCheckLiveness(t *testing.T) {
+	stream, server := pipeStream(t)
+	if !stream.LastReceived().IsZero() {
+		t.Errorf("expected no message to have been received")
+	}
+	if err := stream.CheckLiveness(time.Minute); err != nil {
+		t.Errorf("expected a new stream to be alive, got: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := stream.CheckLiveness(10 * time.Millisecond); !errors.Is(err, firehose.ErrStale) {
+		t.Errorf("expected ErrStale, got: %v", err)
+	}
+
+	serve(server, `{"type":"keepalive","serverTime":"1"}`)
+	if _, err := stream.NextMessage(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stream.CheckLiveness(time.Second); err != nil {
+		t.Errorf("expected the stream to be alive after a message, got: %v", err)
+	}
+	if time.Since(stream.LastReceived()) > time.Second {
+		t.Errorf("unexpected last received time: %v", stream.LastReceived())
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	// Nothing reads from the server end, so writes block until the timeout passes.
+	stream, _ := pipeStream(t, firehose.WithWriteTimeout(50*time.Millisecond))
+	if err := stream.Init("live"); !errors.Is(err, firehose.ErrWriteTimeout) {
+		t.Errorf("expected ErrWriteTimeout from Init, got: %v", err)
+	}
+
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	if err := stream.InitWith(context.Background(), cmd); !errors.Is(err, firehose.ErrWriteTimeout) {
+		t.Errorf("expected ErrWriteTimeout from InitWith, got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := stream.InitWith(ctx, cmd); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the earlier context deadline to apply, got: %v", err)
+	}
+}
+
+func TestInitTimeout(t *testing.T) {
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	respond := func(server net.Conn, lines ...string) {
+		go func() {
+			bufio.NewReader(server).ReadString('\n')
+			for _, line := range lines {
+				fmt.Fprintln(server, line)
+			}
+		}()
+	}
+
+	stream, server := pipeStream(t, firehose.WithInitTimeout(time.Second))
+	respond(server, `{"type":"keepalive","serverTime":"1","pitr":"1000"}`, `{"type":"keepalive","serverTime":"2"}`)
+	if err := stream.InitWith(context.Background(), cmd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"1", "2"} {
+		msg, err := stream.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if km := msg.Payload.(firehose.KeepaliveMessage); km.ServerTime != want {
+			t.Errorf("expected keepalive %s, got %s", want, km.ServerTime)
+		}
+	}
+
+	stream, server = pipeStream(t, firehose.WithInitTimeout(time.Second))
+	respond(server, `{"type":"error","error_msg":"Invalid username or password"}`)
+	if err := stream.InitWith(context.Background(), cmd); !errors.Is(err, firehose.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got: %v", err)
+	}
+
+	stream, server = pipeStream(t, firehose.WithInitTimeout(20*time.Millisecond))
+	respond(server)
+	if err := stream.InitWith(context.Background(), cmd); !errors.Is(err, firehose.ErrInitTimeout) {
+		t.Errorf("expected ErrInitTimeout, got: %v", err)
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	for _, e := range firehose.AllEvents {
+		parsed, err := firehose.ParseEvent(string(e))
+		if err != nil || parsed != e {
+			t.Errorf("could not parse event %q: %v", e, err)
+		}
+	}
+	if _, err := firehose.ParseEvent("postion"); err == nil {
+		t.Errorf("expected error parsing misspelled event")
+	}
+	if _, err := firehose.ParseEvent("keepalive"); err == nil {
+		t.Errorf("expected error parsing keepalive, which is not an event")
+	}
+}
+
+func TestUnmarshalPowerOn(t *testing.T) {
+	data := []byte(`{"type":"power_on","ident":"UAL123","id":"UAL123-1","aircrafttype":"B739","reg":"N12345","clock":"1596066000","pitr":"1596066001"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	po, ok := msg.Payload.(firehose.PowerOnMessage)
+	if !ok {
+		t.Fatalf("payload is not a power on message: %t", msg.Payload)
+	}
+	if po.Reg != "N12345" || po.Clock != "1596066000" || po.Airport != "" || msg.PITR != "1596066001" {
+		t.Errorf("unexpected power on message: %#v", po)
+	}
+}
+
+func TestUnmarshalSurfaceBlock(t *testing.T) {
+	data := []byte(`{"type":"surface_offblock","ident":"UAL123","id":"UAL123-1","airport":"KSFO","clock":"1596066000","gate":"G92","pitr":"1596066001"}`)
+	var msg firehose.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	off, ok := msg.Payload.(firehose.SurfaceOffblockMessage)
+	if !ok {
+		t.Fatalf("payload is not a surface offblock message: %t", msg.Payload)
+	}
+	if off.Airport != "KSFO" || off.Gate != "G92" || off.Clock != "1596066000" || msg.PITR != "1596066001" {
+		t.Errorf("unexpected surface offblock message: %#v", off)
+	}
+
+	data = []byte(`{"type":"surface_onblock","ident":"UAL123","id":"UAL123-1","airport":"KBOS","clock":1596086000}`)
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	on, ok := msg.Payload.(firehose.SurfaceOnblockMessage)
+	if !ok {
+		t.Fatalf("payload is not a surface onblock message: %t", msg.Payload)
+	}
+	if on.Airport != "KBOS" || on.Clock != "1596086000" {
+		t.Errorf("unexpected surface onblock message: %#v", on)
+	}
+}
+
+func TestKeepaliveTimeout(t *testing.T) {
+	stream, server := pipeStream(t, firehose.WithKeepaliveTimeout(100*time.Millisecond))
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(60 * time.Millisecond)
+			fmt.Fprintln(server, `{"type":"keepalive","serverTime":"1"}`)
+		}
+	}()
+
+	// Each message arrives within the timeout of the one before, so none of the reads time out even though the
+	// total time spent exceeds it.
+	for i := 0; i < 3; i++ {
+		if _, err := stream.NextMessage(context.Background()); err != nil {
+			t.Fatalf("unexpected error reading message %d: %v", i, err)
+		}
+	}
+
+	// Time spent between calls counts towards the timeout.
+	time.Sleep(60 * time.Millisecond)
+	start := time.Now()
+	if _, err := stream.NextMessage(context.Background()); !errors.Is(err, firehose.ErrKeepaliveTimeout) {
+		t.Fatalf("expected ErrKeepaliveTimeout, got: %v", err)
+	}
+	if waited := time.Since(start); waited > 80*time.Millisecond {
+		t.Errorf("timeout was not measured from the last message: waited %s", waited)
+	}
+}
+
+func TestUnmarshalNumericStrings(t *testing.T) {
+	for _, data := range []string{
+		`{"type":"position","ident":"WSN145","alt":"1550","gs":"210.5","nac_p":8,"pitr":"1596067800"}`,
+		`{"type":"position","ident":"WSN145","alt":1550,"gs":210.5,"nac_p":"8","pitr":1596067800}`,
+	} {
+		var msg firehose.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("unmarshal error for %s: %v", data, err)
+		}
+		pos := msg.Payload.(firehose.PositionMessage)
+		if pos.Alt != "1550" || pos.GS != "210.5" || pos.NACp != 8 || pos.Ident != "WSN145" || msg.PITR != "1596067800" {
+			t.Errorf("unexpected position decoded from %s: %#v", data, pos)
+		}
+	}
+
+	var msg firehose.Message
+	data := `{"type":"flightplan","ident":"UAL123","alt":35000,"waypoints":[{"lat":"42.36","lon":-71.01,"alt":12000}]}`
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	fp := msg.Payload.(firehose.FlightPlanMessage)
+	if fp.Alt != "35000" || len(fp.Waypoints) != 1 || fp.Waypoints[0].Alt != "12000" || fp.Waypoints[0].Lat != 42.36 {
+		t.Errorf("unexpected flight plan: %#v", fp)
+	}
+
+	if err := json.Unmarshal([]byte(`{"type":"position","alt":true}`), &msg); err == nil {
+		t.Errorf("expected error for a boolean in a string field")
+	}
 }
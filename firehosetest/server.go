@@ -0,0 +1,179 @@
+// Package firehosetest provides a local Firehose server for testing code which consumes the feed.
+package firehosetest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+// A Server is a TLS server on the loopback interface which speaks the Firehose framing: it reads an init command
+// from each connection and then hands the connection to its handler.
+type Server struct {
+	// Addr is the address of the server, in host:port form.
+	Addr string
+
+	listener  net.Listener
+	clientTLS *tls.Config
+	handler   func(*Conn)
+
+	mu    sync.Mutex
+	inits []string
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// A Conn is a client connection to a Server whose init command has been read.
+type Conn struct {
+	net.Conn
+	// Init is the init command sent by the client, without its trailing newline.
+	Init string
+}
+
+// Send writes each of the lines to the client, followed by a newline.
+func (c *Conn) Send(lines ...string) error {
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(c.Conn, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewServer starts a Server which sends each of the messages to every client after reading its init command, and
+// then closes the connection.
+func NewServer(messages ...string) *Server {
+	return NewServerFunc(func(c *Conn) {
+		c.Send(messages...)
+	})
+}
+
+// NewServerFunc starts a Server which calls handler for every client once its init command has been read. The
+// connection is closed when handler returns.
+func NewServerFunc(handler func(*Conn)) *Server {
+	cert, pool := selfSignedCertificate()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		panic(fmt.Sprintf("firehosetest: could not listen: %v", err))
+	}
+	s := &Server{
+		Addr:      listener.Addr().String(),
+		listener:  listener,
+		clientTLS: &tls.Config{RootCAs: pool},
+		handler:   handler,
+		conns:     make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// TLSConfig returns a client TLS configuration which trusts the Server's certificate.
+func (s *Server) TLSConfig() *tls.Config {
+	return s.clientTLS.Clone()
+}
+
+// Options returns the options which make firehose.Dial connect to the Server.
+func (s *Server) Options() []firehose.Option {
+	return []firehose.Option{
+		firehose.WithAddress(s.Addr),
+		firehose.WithTLSConfig(s.TLSConfig()),
+	}
+}
+
+// Inits returns the init commands received so far, in the order they were received.
+func (s *Server) Inits() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.inits...)
+}
+
+// Close stops the Server, closes any open connections, and waits for their handlers to return.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	init, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	init = strings.TrimRight(init, "\r\n")
+	s.mu.Lock()
+	s.inits = append(s.inits, init)
+	s.mu.Unlock()
+
+	s.handler(&Conn{Conn: conn, Init: init})
+}
+
+// selfSignedCertificate creates a certificate for the loopback address, along with a pool which trusts it.
+func selfSignedCertificate() (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("firehosetest: could not generate key: %v", err))
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"firehosetest"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("firehosetest: could not create certificate: %v", err))
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("firehosetest: could not parse certificate: %v", err))
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
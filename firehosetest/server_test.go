@@ -0,0 +1,65 @@
+package firehosetest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/benburwell/firehose"
+	"github.com/benburwell/firehose/firehosetest"
+)
+
+func TestServer(t *testing.T) {
+	srv := firehosetest.NewServer(
+		`{"type":"position","ident":"A","pitr":"1001"}`,
+		`{"type":"keepalive","serverTime":"1","pitr":"1002"}`,
+	)
+	defer srv.Close()
+
+	stream, err := firehose.Dial(context.Background(), srv.Options()...)
+	if err != nil {
+		t.Fatalf("could not dial test server: %v", err)
+	}
+	defer stream.Close()
+
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	if err := stream.Init(cmd.String()); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	for _, want := range []string{"position", "keepalive"} {
+		msg, err := stream.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if msg.Type != want {
+			t.Errorf("expected %s message, got %s", want, msg.Type)
+		}
+	}
+	if _, err := stream.NextMessage(context.Background()); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF after the server's messages, got: %v", err)
+	}
+
+	if inits := srv.Inits(); len(inits) != 1 || inits[0] != cmd.String() {
+		t.Errorf("unexpected init commands: %q", inits)
+	}
+}
+
+func TestServerFunc(t *testing.T) {
+	srv := firehosetest.NewServerFunc(func(c *firehosetest.Conn) {
+		c.Send(`{"type":"error","error_msg":"Invalid username or password"}`)
+	})
+	defer srv.Close()
+
+	stream, err := firehose.Dial(context.Background(), srv.Options()...)
+	if err != nil {
+		t.Fatalf("could not dial test server: %v", err)
+	}
+	defer stream.Close()
+	if err := stream.Init("live username un password pw"); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	if _, err := stream.NextMessage(context.Background()); !errors.Is(err, firehose.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build go1.23
+
+package firehose
+
+import (
+	"context"
+	"iter"
+)
+
+// All returns an iterator over the messages of the Stream, for use in a range loop:
+//
+//	for msg, err := range stream.All(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		// ...
+//	}
+//
+// Each message is yielded with a nil error. The first error returned by NextMessage, including the context's error
+// once ctx is done, ends the iteration: it is yielded exactly once, together with any message NextMessage returned
+// alongside it. Breaking out of the loop stops reading; the Stream is not closed.
+func (c *Stream) All(ctx context.Context) iter.Seq2[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		for {
+			msg, err := c.NextMessage(ctx)
+			if err != nil {
+				yield(msg, err)
+				return
+			}
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+//go:build go1.23
+
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestStreamAll(t *testing.T) {
+	stream := firehose.NewReader(strings.NewReader(`{"type":"position","ident":"A"}
+{"type":"position","ident":"B"}
+`))
+
+	var idents []string
+	var errs []error
+	for msg, err := range stream.All(context.Background()) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		idents = append(idents, msg.Payload.(firehose.PositionMessage).Ident)
+	}
+	if len(idents) != 2 || idents[0] != "A" || idents[1] != "B" {
+		t.Errorf("unexpected messages: %v", idents)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], io.EOF) {
+		t.Errorf("expected a single EOF error, got: %v", errs)
+	}
+}
+
+func TestStreamAllBreak(t *testing.T) {
+	stream, server := pipeStream(t)
+	serve(server,
+		`{"type":"position","ident":"A"}`,
+		`{"type":"position","ident":"B"}`,
+	)
+
+	for range stream.All(context.Background()) {
+		break
+	}
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error after breaking out of All: %v", err)
+	}
+	if pos := msg.Payload.(firehose.PositionMessage); pos.Ident != "B" {
+		t.Errorf("expected the message after the one consumed by All, got: %#v", pos)
+	}
+}
@@ -0,0 +1,134 @@
+package firehose
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// unmarshalLenient decodes data into v like json.Unmarshal, but tolerates the server sending a JSON number for a field
+// declared as a string, or a numeric string for a field declared as a number.
+//
+// Firehose documents almost every field as a string, but occasionally sends numbers instead, depending on the field
+// and the subscription. The common case is decoded directly; only when that fails with a type mismatch is the
+// message rewritten to match the types of v and decoded again.
+func unmarshalLenient(data []byte, v any) error {
+	err := json.Unmarshal(data, v)
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	normalized, ok := normalizeJSON(data, reflect.TypeOf(v).Elem())
+	if !ok {
+		return err
+	}
+	return json.Unmarshal(normalized, v)
+}
+
+// normalizeJSON rewrites the JSON value in data so that its scalars match the kinds expected by t, reporting whether
+// anything was changed.
+func normalizeJSON(data []byte, t reflect.Type) ([]byte, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return data, false
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if isJSONNumber(data) {
+			return []byte(strconv.Quote(string(data))), true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if data[0] == '"' {
+			var s string
+			if json.Unmarshal(data, &s) == nil && isJSONNumber([]byte(s)) {
+				return []byte(s), true
+			}
+		}
+	case reflect.Slice:
+		var elems []json.RawMessage
+		if data[0] != '[' || json.Unmarshal(data, &elems) != nil {
+			return data, false
+		}
+		changed := false
+		for i, elem := range elems {
+			if normalized, ok := normalizeJSON(elem, t.Elem()); ok {
+				elems[i] = normalized
+				changed = true
+			}
+		}
+		if changed {
+			out, err := json.Marshal(elems)
+			return out, err == nil
+		}
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if data[0] != '{' || json.Unmarshal(data, &fields) != nil {
+			return data, false
+		}
+		changed := false
+		for key, value := range fields {
+			ft, ok := fieldType(t, key)
+			if !ok {
+				continue
+			}
+			if normalized, ok := normalizeJSON(value, ft); ok {
+				fields[key] = normalized
+				changed = true
+			}
+		}
+		if changed {
+			out, err := json.Marshal(fields)
+			return out, err == nil
+		}
+	}
+	return data, false
+}
+
+// fieldType returns the type of the field of struct type t which encoding/json would decode the given key into.
+func fieldType(t reflect.Type, key string) (reflect.Type, bool) {
+	var folded reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if ft, ok := fieldType(f.Type, key); ok {
+				return ft, true
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if name == key {
+			return f.Type, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = f.Type
+		}
+	}
+	return folded, folded != nil
+}
+
+// isJSONNumber reports whether data is a JSON number literal.
+func isJSONNumber(data []byte) bool {
+	if len(data) == 0 || (data[0] != '-' && (data[0] < '0' || data[0] > '9')) {
+		return false
+	}
+	var n json.Number
+	return json.Unmarshal(data, &n) == nil
+}
@@ -0,0 +1,163 @@
+package firehose
+
+import (
+	"sync"
+	"time"
+)
+
+// LifecycleStage is a step in the life of a flight.
+type LifecycleStage int
+
+const (
+	// StageFiled indicates that a flight plan has been filed.
+	StageFiled LifecycleStage = iota + 1
+	// StageDeparted indicates that the flight has departed its origin.
+	StageDeparted
+	// StageAirborne indicates that the flight has reported an airborne position.
+	StageAirborne
+	// StageLanded indicates that the flight has arrived or reported a position on the ground after being airborne.
+	StageLanded
+	// StageCancelled indicates that the flight was cancelled before departing.
+	StageCancelled
+)
+
+// String returns a human-readable name for the stage.
+func (s LifecycleStage) String() string {
+	switch s {
+	case StageFiled:
+		return "filed"
+	case StageDeparted:
+		return "departed"
+	case StageAirborne:
+		return "airborne"
+	case StageLanded:
+		return "landed"
+	case StageCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// terminal reports whether no further stages can follow s.
+func (s LifecycleStage) terminal() bool {
+	return s == StageLanded || s == StageCancelled
+}
+
+// A LifecycleEvent reports that a flight has reached a new stage.
+type LifecycleEvent struct {
+	// ID is the FlightAware Flight ID.
+	ID string
+	// Stage is the stage which the flight has reached.
+	Stage LifecycleStage
+	// Time is the time at which the underlying message reported the transition.
+	Time time.Time
+}
+
+// A FlightLifecycle turns the raw messages of a Firehose stream into higher-level events describing how each flight
+// progresses.
+//
+// Each flight moves forward through the stages Filed, Departed, Airborne, and Landed, or from Filed to Cancelled.
+// Landed and Cancelled are terminal. A flight may enter the state machine at any stage, and an event is emitted only
+// when a flight moves to a later stage than the one it is already in: because messages can arrive out of order, a
+// message describing an earlier stage than the current one is ignored, and stages which were skipped are not
+// reported retroactively. A cancellation is only accepted while the flight has not yet departed.
+//
+// A flight plan moves a flight to Filed, a departure to Departed, an arrival to Landed, and a cancellation to
+// Cancelled. Airborne positions move a flight to Airborne; a position on the ground following an airborne one moves it
+// to Landed.
+//
+// A FlightLifecycle remembers every flight it has seen until Forget is called. It is safe for concurrent use, and the
+// event callback is invoked without holding the FlightLifecycle's lock.
+type FlightLifecycle struct {
+	mu      sync.Mutex
+	flights map[string]LifecycleStage
+	onEvent func(LifecycleEvent)
+}
+
+// NewFlightLifecycle creates an empty FlightLifecycle.
+func NewFlightLifecycle() *FlightLifecycle {
+	return &FlightLifecycle{
+		flights: make(map[string]LifecycleStage),
+	}
+}
+
+// OnEvent registers a callback which is invoked for every lifecycle transition.
+func (l *FlightLifecycle) OnEvent(fn func(LifecycleEvent)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onEvent = fn
+}
+
+// Observe processes a message from the stream. Messages which say nothing about a flight's lifecycle are ignored.
+func (l *FlightLifecycle) Observe(msg *Message) {
+	switch m := msg.Payload.(type) {
+	case FlightPlanMessage:
+		if at, err := parseEpoch(m.PITR); err == nil {
+			l.Advance(m.ID, StageFiled, at)
+		}
+	case DepartureMessage:
+		if at, err := parseEpoch(m.ADT); err == nil {
+			l.Advance(m.ID, StageDeparted, at)
+		}
+	case ArrivalMessage:
+		if at, err := parseEpoch(m.AAT); err == nil {
+			l.Advance(m.ID, StageLanded, at)
+		}
+	case CancellationMessage:
+		if at, err := parseEpoch(m.PITR); err == nil {
+			l.Advance(m.ID, StageCancelled, at)
+		}
+	case PositionMessage:
+		at, err := parseEpoch(m.Clock)
+		if err != nil {
+			return
+		}
+		if m.AirGround == AirGroundAir {
+			l.Advance(m.ID, StageAirborne, at)
+			return
+		}
+		l.mu.Lock()
+		airborne := l.flights[m.ID] == StageAirborne
+		l.mu.Unlock()
+		if airborne {
+			l.Advance(m.ID, StageLanded, at)
+		}
+	}
+}
+
+// Advance moves the flight with the given ID to stage, emitting an event if this is a forward transition.
+func (l *FlightLifecycle) Advance(id string, stage LifecycleStage, at time.Time) {
+	if id == "" {
+		return
+	}
+
+	l.mu.Lock()
+	current, ok := l.flights[id]
+	if ok && (current.terminal() || stage <= current || (stage == StageCancelled && current >= StageDeparted)) {
+		l.mu.Unlock()
+		return
+	}
+	l.flights[id] = stage
+	onEvent := l.onEvent
+	l.mu.Unlock()
+
+	if onEvent != nil {
+		onEvent(LifecycleEvent{ID: id, Stage: stage, Time: at})
+	}
+}
+
+// Stage returns the current stage of the flight with the given ID.
+func (l *FlightLifecycle) Stage(id string) (LifecycleStage, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stage, ok := l.flights[id]
+	return stage, ok
+}
+
+// Forget discards all state for the flight with the given ID.
+func (l *FlightLifecycle) Forget(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.flights, id)
+}
@@ -0,0 +1,110 @@
+package firehose_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+// recordLifecycle returns a FlightLifecycle along with a pointer to the stages it has emitted.
+func recordLifecycle() (*firehose.FlightLifecycle, *[]firehose.LifecycleStage) {
+	l := firehose.NewFlightLifecycle()
+	var stages []firehose.LifecycleStage
+	l.OnEvent(func(e firehose.LifecycleEvent) {
+		stages = append(stages, e.Stage)
+	})
+	return l, &stages
+}
+
+func position(id, clock string, airGround firehose.AirGround) *firehose.Message {
+	return &firehose.Message{
+		Type:    "position",
+		Payload: firehose.PositionMessage{Type: "position", ID: id, Clock: clock, AirGround: airGround},
+	}
+}
+
+func expectStages(t *testing.T, actual []firehose.LifecycleStage, expected ...firehose.LifecycleStage) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected stages %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected stages %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestFlightLifecycle(t *testing.T) {
+	l, stages := recordLifecycle()
+
+	l.Advance("f1", firehose.StageFiled, time.Unix(100, 0))
+	l.Advance("f1", firehose.StageDeparted, time.Unix(200, 0))
+	l.Observe(position("f1", "210", "G"))
+	l.Observe(position("f1", "220", "A"))
+	l.Observe(position("f1", "230", "A"))
+	l.Observe(position("f1", "900", "G"))
+	l.Observe(position("f1", "910", "G"))
+
+	expectStages(t, *stages,
+		firehose.StageFiled,
+		firehose.StageDeparted,
+		firehose.StageAirborne,
+		firehose.StageLanded,
+	)
+	if stage, _ := l.Stage("f1"); stage != firehose.StageLanded {
+		t.Errorf("unexpected final stage: %s", stage)
+	}
+}
+
+func TestFlightLifecycleOutOfOrder(t *testing.T) {
+	l, stages := recordLifecycle()
+
+	l.Observe(position("f1", "220", "A"))
+	l.Advance("f1", firehose.StageDeparted, time.Unix(200, 0))
+	l.Advance("f1", firehose.StageFiled, time.Unix(100, 0))
+	l.Advance("f1", firehose.StageCancelled, time.Unix(300, 0))
+
+	expectStages(t, *stages, firehose.StageAirborne)
+}
+
+func TestFlightLifecycleCancelled(t *testing.T) {
+	l, stages := recordLifecycle()
+
+	l.Advance("f1", firehose.StageFiled, time.Unix(100, 0))
+	l.Advance("f1", firehose.StageCancelled, time.Unix(200, 0))
+	l.Observe(position("f1", "300", "A"))
+
+	expectStages(t, *stages, firehose.StageFiled, firehose.StageCancelled)
+
+	l.Forget("f1")
+	if _, ok := l.Stage("f1"); ok {
+		t.Errorf("expected flight to be forgotten")
+	}
+}
+
+func TestFlightLifecycleFlightPlan(t *testing.T) {
+	l, stages := recordLifecycle()
+	l.Observe(&firehose.Message{
+		Type:    "flightplan",
+		Payload: firehose.FlightPlanMessage{Type: "flightplan", ID: "f1", PITR: "100"},
+	})
+	l.Observe(position("f1", "200", "A"))
+	expectStages(t, *stages, firehose.StageFiled, firehose.StageAirborne)
+}
+
+func TestFlightLifecycleDepartureArrival(t *testing.T) {
+	l, stages := recordLifecycle()
+	l.Observe(&firehose.Message{Type: "departure", Payload: firehose.DepartureMessage{ID: "f1", ADT: "100"}})
+	l.Observe(position("f1", "110", "A"))
+	l.Observe(&firehose.Message{Type: "arrival", Payload: firehose.ArrivalMessage{ID: "f1", AAT: "900"}})
+	expectStages(t, *stages, firehose.StageDeparted, firehose.StageAirborne, firehose.StageLanded)
+}
+
+func TestFlightLifecycleCancellation(t *testing.T) {
+	l, stages := recordLifecycle()
+	l.Observe(&firehose.Message{Type: "flightplan", Payload: firehose.FlightPlanMessage{ID: "f1", PITR: "100"}})
+	l.Observe(&firehose.Message{Type: "cancellation", Payload: firehose.CancellationMessage{ID: "f1", PITR: "200"}})
+	expectStages(t, *stages, firehose.StageFiled, firehose.StageCancelled)
+}
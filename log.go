@@ -0,0 +1,14 @@
+package firehose
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler is a slog.Handler which drops every record, used when no logger is configured.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
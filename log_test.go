@@ -0,0 +1,60 @@
+package firehose_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	stream, server := pipeStream(t, firehose.WithLogger(logger))
+	go func() {
+		buf := make([]byte, 1024)
+		server.Read(buf)
+		server.Write([]byte(`{"type":"mystery"}` + "\n"))
+		server.Close()
+	}()
+
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "secret"}
+	if err := stream.InitWith(context.Background(), cmd); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	for {
+		if _, err := stream.NextMessage(context.Background()); err != nil {
+			break
+		}
+	}
+
+	logged := buf.String()
+	for _, want := range []string{"sent init command", "received message of unknown type", "type=mystery", "read failed"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, logged)
+		}
+	}
+	if strings.Contains(logged, "secret") {
+		t.Errorf("password leaked into log:\n%s", logged)
+	}
+}
+
+func TestWithNilLogger(t *testing.T) {
+	stream, server := pipeStream(t, firehose.WithLogger(nil))
+	go func() {
+		buf := make([]byte, 1024)
+		server.Read(buf)
+		server.Write([]byte(`{"type":"mystery"}` + "\n"))
+	}()
+
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	if err := stream.InitWith(context.Background(), cmd); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	if _, err := stream.NextMessage(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package firehose
+
+import "sync"
+
+// messagePool holds Messages released with ReleaseMessage for reuse by Streams.
+var messagePool = sync.Pool{
+	New: func() any { return new(Message) },
+}
+
+// newMessage returns an empty Message, reusing a released one if possible.
+func newMessage() *Message {
+	return messagePool.Get().(*Message)
+}
+
+// ReleaseMessage returns msg to a pool from which Streams allocate the Messages they return, reducing the garbage
+// produced by a busy feed. Calling it is optional; a Message which is never released is simply garbage collected.
+//
+// Once released, msg belongs to the pool and may be handed out again by any Stream, so neither msg nor any pointer to
+// it may be used afterwards. Values copied out of the Message before it is released remain valid, including the
+// payload: since every payload type is a value, a payload extracted with a type assertion or type switch does not
+// share memory with the Message.
+//
+// A Message must not be released while another goroutine may still be using it, such as a Message which has also
+// been sent on a channel, and must not be released more than once.
+func ReleaseMessage(msg *Message) {
+	if msg == nil {
+		return
+	}
+	*msg = Message{}
+	messagePool.Put(msg)
+}
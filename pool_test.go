@@ -0,0 +1,33 @@
+package firehose_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestReleaseMessage(t *testing.T) {
+	stream := firehose.NewReader(strings.NewReader(`{"type":"position","ident":"A","pitr":"1"}
+{"type":"keepalive","serverTime":"2"}
+`))
+	msg, err := stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pos := msg.Payload.(firehose.PositionMessage)
+	firehose.ReleaseMessage(msg)
+
+	msg, err = stream.NextMessage(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != "keepalive" || msg.PITR != "" {
+		t.Errorf("reused message kept stale fields: %+v", msg)
+	}
+	if pos.Ident != "A" {
+		t.Errorf("payload copied before release was modified: %+v", pos)
+	}
+	firehose.ReleaseMessage(nil)
+}
@@ -0,0 +1,652 @@
+package firehose
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnmarshalJSON implements json.Unmarshaler for PositionMessage.
+//
+// Some Firehose messages carry the altitude change code under the key "altChange" rather than the documented
+// "alt_change"; both are accepted.
+func (p *PositionMessage) UnmarshalJSON(data []byte) error {
+	type position PositionMessage
+	var aux struct {
+		position
+		AltChangeAlias string `json:"altChange"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*p = PositionMessage(aux.position)
+	if p.AltChange == "" {
+		p.AltChange = aux.AltChangeAlias
+	}
+	return nil
+}
+
+// UpdateType identifies the source of a position report.
+type UpdateType string
+
+const (
+	// UpdateTypeADSB indicates a position from ADS-B.
+	UpdateTypeADSB UpdateType = "A"
+	// UpdateTypeRadar indicates a position from radar.
+	UpdateTypeRadar UpdateType = "Z"
+	// UpdateTypeTransoceanic indicates a position from transoceanic tracking.
+	UpdateTypeTransoceanic UpdateType = "O"
+	// UpdateTypeEstimated indicates a position estimated by FlightAware.
+	UpdateTypeEstimated UpdateType = "P"
+	// UpdateTypeDatalink indicates a position from datalink.
+	UpdateTypeDatalink UpdateType = "D"
+	// UpdateTypeMLAT indicates a position from multilateration.
+	UpdateTypeMLAT UpdateType = "M"
+	// UpdateTypeASDEX indicates a position from ASDE-X surface surveillance.
+	UpdateTypeASDEX UpdateType = "X"
+	// UpdateTypeSpaceADSB indicates a position from space-based ADS-B.
+	UpdateTypeSpaceADSB UpdateType = "S"
+)
+
+// Description returns a human-readable label for the update type, or "unknown" if it is not recognized.
+func (u UpdateType) Description() string {
+	switch u {
+	case UpdateTypeADSB:
+		return "ADS-B"
+	case UpdateTypeRadar:
+		return "radar"
+	case UpdateTypeTransoceanic:
+		return "transoceanic"
+	case UpdateTypeEstimated:
+		return "estimated"
+	case UpdateTypeDatalink:
+		return "datalink"
+	case UpdateTypeMLAT:
+		return "multilateration"
+	case UpdateTypeASDEX:
+		return "ASDE-X"
+	case UpdateTypeSpaceADSB:
+		return "space-based ADS-B"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseUpdateType returns the UpdateType with the given code, or an error if the code is not recognized.
+func ParseUpdateType(s string) (UpdateType, error) {
+	u := UpdateType(s)
+	if u.Description() == "unknown" {
+		return "", fmt.Errorf("unknown update type %q", s)
+	}
+	return u, nil
+}
+
+// AirGround indicates whether an aircraft is airborne or on the ground.
+type AirGround string
+
+const (
+	// AirGroundAir indicates that the aircraft is airborne.
+	AirGroundAir AirGround = "A"
+	// AirGroundGround indicates that the aircraft is on the ground.
+	AirGroundGround AirGround = "G"
+	// AirGroundWOW indicates that the aircraft's weight-on-wheels sensor reports it is on the ground.
+	AirGroundWOW AirGround = "WOW"
+)
+
+// Description returns a human-readable label for the value, or "unknown" if it is not recognized.
+func (a AirGround) Description() string {
+	switch a {
+	case AirGroundAir:
+		return "air"
+	case AirGroundGround:
+		return "ground"
+	case AirGroundWOW:
+		return "weight-on-wheels"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseAirGround returns the AirGround with the given code, or an error if the code is not recognized.
+func ParseAirGround(s string) (AirGround, error) {
+	a := AirGround(s)
+	if a.Description() == "unknown" {
+		return "", fmt.Errorf("unknown air/ground code %q", s)
+	}
+	return a, nil
+}
+
+// AltitudeTrend describes whether an aircraft is climbing, descending, or holding its altitude.
+type AltitudeTrend int
+
+const (
+	// TrendUnknown indicates that no altitude change code was reported.
+	TrendUnknown AltitudeTrend = iota
+	// TrendLevel indicates that the aircraft is neither climbing nor descending.
+	TrendLevel
+	// TrendClimbing indicates that the aircraft is climbing.
+	TrendClimbing
+	// TrendDescending indicates that the aircraft is descending.
+	TrendDescending
+)
+
+// String returns a human-readable name for the trend.
+func (t AltitudeTrend) String() string {
+	switch t {
+	case TrendLevel:
+		return "level"
+	case TrendClimbing:
+		return "climbing"
+	case TrendDescending:
+		return "descending"
+	default:
+		return "unknown"
+	}
+}
+
+// Trend interprets the AltChange code of the position.
+//
+// Firehose sends a single space when no climb or descent has been detected, which is reported as TrendLevel. A missing
+// or unrecognized code is reported as TrendUnknown.
+func (p PositionMessage) Trend() AltitudeTrend {
+	switch p.AltChange {
+	case "C":
+		return TrendClimbing
+	case "D":
+		return TrendDescending
+	case " ":
+		return TrendLevel
+	default:
+		return TrendUnknown
+	}
+}
+
+// Latitude returns Lat in decimal degrees, or zero if it is missing or malformed.
+func (p PositionMessage) Latitude() float64 {
+	lat, _ := optionalFloat(p.Lat)
+	return lat
+}
+
+// Longitude returns Lon in decimal degrees, or zero if it is missing or malformed.
+func (p PositionMessage) Longitude() float64 {
+	lon, _ := optionalFloat(p.Lon)
+	return lon
+}
+
+// Altitude returns Alt in feet, if it is present and numeric. Aircraft on the ground may report a non-numeric
+// altitude, which is reported as not ok. Fractional altitudes are truncated.
+func (p PositionMessage) Altitude() (int, bool) {
+	return optionalAltitude(p.Alt)
+}
+
+// optionalAltitude parses an optional altitude field, truncating any fractional feet.
+func optionalAltitude(s string) (int, bool) {
+	if alt, err := strconv.Atoi(s); err == nil {
+		return alt, true
+	}
+	alt, ok := optionalFloat(s)
+	return int(alt), ok
+}
+
+// GroundSpeed returns GS in knots, if it is present and numeric.
+func (p PositionMessage) GroundSpeed() (float64, bool) {
+	return optionalFloat(p.GS)
+}
+
+// HeadingDeg returns Heading in degrees, if it is present and numeric.
+func (p PositionMessage) HeadingDeg() (float64, bool) {
+	return optionalFloat(p.Heading)
+}
+
+// PositionQuality gathers the ADS-B accuracy and integrity categories reported with a position. A category of zero
+// means that it is unknown, either because it was not reported or because the transmitter reported it as unknown,
+// which ADS-B also encodes as zero.
+type PositionQuality struct {
+	// NACp is the Navigational Accuracy Category for Position.
+	NACp int
+	// NACv is the Navigational Accuracy Category for Velocity.
+	NACv int
+	// NIC is the Navigational Integrity Category.
+	NIC int
+	// NICBaro is the Navigational Integrity Category for Barometer.
+	NICBaro int
+	// SIL is the Source Integrity Level.
+	SIL int
+	// SILType is the period to which SIL applies: "perhour", "persample", or "unknown".
+	SILType string
+	// PosRC is the Radius of Containment, in meters, or zero if unknown.
+	PosRC float64
+}
+
+// Quality returns the ADS-B accuracy and integrity categories reported with the position.
+func (p PositionMessage) Quality() PositionQuality {
+	return PositionQuality{
+		NACp:    p.NACp,
+		NACv:    p.NACv,
+		NIC:     p.NIC,
+		NICBaro: p.NICBaro,
+		SIL:     p.SIL,
+		SILType: p.SILType,
+		PosRC:   p.PosRC,
+	}
+}
+
+// IsHighIntegrity reports whether the categories meet the minimum performance required of ADS-B Out equipment in US
+// airspace by 14 CFR 91.227: NACp of at least 8, NACv of at least 1, NIC of at least 7, and SIL of 3. Unknown
+// categories never meet the requirements, so positions from sources other than ADS-B, which carry no categories, are
+// never high integrity.
+func (q PositionQuality) IsHighIntegrity() bool {
+	return q.NACp >= 8 && q.NACv >= 1 && q.NIC >= 7 && q.SIL >= 3
+}
+
+// HeadingRef identifies the reference direction of a heading.
+type HeadingRef int
+
+const (
+	// HeadingUnknown indicates a heading whose reference is not reported.
+	HeadingUnknown HeadingRef = iota
+	// HeadingTrue indicates a heading relative to true North.
+	HeadingTrue
+	// HeadingMagnetic indicates a heading relative to magnetic North.
+	HeadingMagnetic
+)
+
+// String returns a human-readable name for the reference.
+func (r HeadingRef) String() string {
+	switch r {
+	case HeadingTrue:
+		return "true"
+	case HeadingMagnetic:
+		return "magnetic"
+	default:
+		return "unknown"
+	}
+}
+
+// BestHeading returns the most precise heading reported, in degrees, along with its reference: HeadingTrue if it is
+// present and numeric, then HeadingMagnetic, and finally Heading, whose reference is unknown.
+func (p PositionMessage) BestHeading() (deg float64, ref HeadingRef, ok bool) {
+	if deg, ok := optionalFloat(p.HeadingTrue); ok {
+		return deg, HeadingTrue, true
+	}
+	if deg, ok := optionalFloat(p.HeadingMagnetic); ok {
+		return deg, HeadingMagnetic, true
+	}
+	if deg, ok := optionalFloat(p.Heading); ok {
+		return deg, HeadingUnknown, true
+	}
+	return 0, HeadingUnknown, false
+}
+
+// VertRateSource identifies the altitude from which a vertical rate is derived.
+type VertRateSource int
+
+const (
+	// VertRateNone indicates that no vertical rate is reported.
+	VertRateNone VertRateSource = iota
+	// VertRateGeometric indicates a rate derived from GNSS altitude.
+	VertRateGeometric
+	// VertRateBarometric indicates a rate derived from pressure altitude.
+	VertRateBarometric
+)
+
+// String returns a human-readable name for the source.
+func (s VertRateSource) String() string {
+	switch s {
+	case VertRateGeometric:
+		return "geometric"
+	case VertRateBarometric:
+		return "barometric"
+	default:
+		return "none"
+	}
+}
+
+// VerticalRate returns the vertical rate in feet per minute, positive when climbing, along with its source:
+// VertRateGeometric if VertRateGeom is present and numeric, and otherwise VertRateBarometric from VertRate.
+func (p PositionMessage) VerticalRate() (fpm float64, source VertRateSource, ok bool) {
+	if fpm, ok := optionalFloat(p.VertRateGeom); ok {
+		return fpm, VertRateGeometric, true
+	}
+	if fpm, ok := optionalFloat(p.VertRate); ok {
+		return fpm, VertRateBarometric, true
+	}
+	return 0, VertRateNone, false
+}
+
+// Wind returns the derived wind direction, in degrees relative to true North, and speed, in knots. reliable reports
+// whether WindQuality indicates that the aircraft was stable, so that the derivation can be trusted. ok is false
+// unless both the direction and speed are present and numeric.
+func (p PositionMessage) Wind() (dir, speed float64, reliable bool, ok bool) {
+	dir, dirOK := optionalFloat(p.WindDir)
+	speed, speedOK := optionalFloat(p.WindSpeed)
+	if !dirOK || !speedOK {
+		return 0, 0, false, false
+	}
+	return dir, speed, p.WindQuality == "1", true
+}
+
+// OutsideAirTemp returns the derived outside air temperature in degrees Celsius. reliable reports whether
+// TemperatureQuality is 1, meaning that the value is not thought to suffer from quantization errors; a missing quality
+// is treated as unreliable. ok is false unless Temperature is present and numeric.
+func (p PositionMessage) OutsideAirTemp() (celsius float64, reliable bool, ok bool) {
+	celsius, ok = optionalFloat(p.Temperature)
+	if !ok {
+		return 0, false, false
+	}
+	return celsius, p.TemperatureQuality == "1", true
+}
+
+// SquawkCode returns the transponder code from Squawk, reporting false unless it is four octal digits.
+func (p PositionMessage) SquawkCode() (code string, ok bool) {
+	code = strings.TrimSpace(p.Squawk)
+	if len(code) != 4 {
+		return "", false
+	}
+	for _, d := range code {
+		if d < '0' || d > '7' {
+			return "", false
+		}
+	}
+	return code, true
+}
+
+// EmergencyType identifies an emergency declared by setting one of the standard emergency squawk codes.
+type EmergencyType int
+
+const (
+	// EmergencyNone indicates that no emergency code is set.
+	EmergencyNone EmergencyType = iota
+	// EmergencyHijack indicates unlawful interference, squawk 7500.
+	EmergencyHijack
+	// EmergencyRadioFailure indicates a loss of radio communication, squawk 7600.
+	EmergencyRadioFailure
+	// EmergencyGeneral indicates a general emergency, squawk 7700.
+	EmergencyGeneral
+)
+
+// String returns a human-readable name for the emergency.
+func (e EmergencyType) String() string {
+	switch e {
+	case EmergencyHijack:
+		return "hijack"
+	case EmergencyRadioFailure:
+		return "radio failure"
+	case EmergencyGeneral:
+		return "general emergency"
+	default:
+		return "none"
+	}
+}
+
+// Emergency returns the emergency indicated by the squawk code, reporting false if it is not one of 7500, 7600, or
+// 7700.
+func (p PositionMessage) Emergency() (EmergencyType, bool) {
+	code, _ := p.SquawkCode()
+	switch code {
+	case "7500":
+		return EmergencyHijack, true
+	case "7600":
+		return EmergencyRadioFailure, true
+	case "7700":
+		return EmergencyGeneral, true
+	default:
+		return EmergencyNone, false
+	}
+}
+
+// FuelUnit is the unit in which an amount of fuel is reported.
+type FuelUnit string
+
+const (
+	// FuelLiters indicates an amount in liters.
+	FuelLiters FuelUnit = "LITERS"
+	// FuelGallons indicates an amount in US gallons.
+	FuelGallons FuelUnit = "GALLONS"
+	// FuelPounds indicates an amount in pounds.
+	FuelPounds FuelUnit = "POUNDS"
+	// FuelKilograms indicates an amount in kilograms.
+	FuelKilograms FuelUnit = "KILOGRAMS"
+	// FuelUnknown indicates that the unit was not known to the source.
+	FuelUnknown FuelUnit = "UNKNOWN"
+)
+
+// kilogramsPerPound is the exact definition of the international avoirdupois pound.
+const kilogramsPerPound = 0.45359237
+
+// Fuel returns the amount of fuel on board and its unit, if FuelOnBoard is present and numeric. A unit missing from
+// the message is reported as FuelUnknown.
+func (p PositionMessage) Fuel() (float64, FuelUnit, bool) {
+	amount, ok := optionalFloat(p.FuelOnBoard)
+	if !ok {
+		return 0, "", false
+	}
+	unit := p.FuelOnBoardUnit
+	if unit == "" {
+		unit = FuelUnknown
+	}
+	return amount, unit, true
+}
+
+// FuelKilograms returns the mass of fuel on board in kilograms. Only amounts reported in kilograms or pounds can be
+// converted; volumes would require the fuel's density, so they are reported as not ok, as are unknown units.
+func (p PositionMessage) FuelKilograms() (float64, bool) {
+	amount, unit, ok := p.Fuel()
+	if !ok {
+		return 0, false
+	}
+	switch unit {
+	case FuelKilograms:
+		return amount, true
+	case FuelPounds:
+		return amount * kilogramsPerPound, true
+	default:
+		return 0, false
+	}
+}
+
+// optionalFloat parses an optional numeric field, reporting false if it is empty or malformed.
+func optionalFloat(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// Origin returns the place the flight departed from, given by Orig, recognizing a coordinate in the form
+// "L 9.13179 -81.43443" as well as an airport code. It reports false if Orig is empty or is a malformed coordinate.
+func (p PositionMessage) Origin() (Place, bool) {
+	return parsePlace(p.Orig)
+}
+
+// Destination returns the place the flight is bound for, given by Dest, in the same way as Origin.
+func (p PositionMessage) Destination() (Place, bool) {
+	return parsePlace(p.Dest)
+}
+
+// Identity holds the names by which a flight is known. ATCIdent and Registration are only set if they differ from
+// Callsign.
+type Identity struct {
+	// Callsign is the flight identifier, from Ident.
+	Callsign string
+	// ATCIdent is the identifier used by ATC.
+	ATCIdent string
+	// Registration is the tail number or registration of the aircraft.
+	Registration string
+}
+
+// DisplayName returns the most recognizable of the names which are set, preferring the callsign, then the
+// registration, and finally the ATC identifier. It returns an empty string if none are set.
+func (i Identity) DisplayName() string {
+	for _, name := range []string{i.Callsign, i.Registration, i.ATCIdent} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// Identity returns the names by which the flight is known, leaving out ATCIdent and Reg where they repeat Ident.
+func (p PositionMessage) Identity() Identity {
+	id := Identity{Callsign: p.Ident}
+	if p.ATCIdent != p.Ident {
+		id.ATCIdent = p.ATCIdent
+	}
+	if p.Reg != p.Ident {
+		id.Registration = p.Reg
+	}
+	return id
+}
+
+// DisplayName returns the name best suited to labelling the flight; see Identity.DisplayName.
+func (p PositionMessage) DisplayName() string {
+	return p.Identity().DisplayName()
+}
+
+// ContainsPosition reports whether the position lies within the Rectangle, as for Contains. A position without valid
+// coordinates is never contained.
+func (r Rectangle) ContainsPosition(p PositionMessage) bool {
+	lat, latOK := optionalFloat(p.Lat)
+	lon, lonOK := optionalFloat(p.Lon)
+	return latOK && lonOK && r.Contains(lat, lon)
+}
+
+// InLatLong reports whether the position lies within at least one of the rectangles of the LatLong filter, as for
+// Rectangle.ContainsPosition. Since the server keeps sending positions for a flight which has left the rectangles,
+// this distinguishes flights currently inside them from those which are only remembered. If no LatLong filter is set,
+// every position is reported as inside.
+func (i *InitCommand) InLatLong(p PositionMessage) bool {
+	if len(i.LatLong) == 0 {
+		return true
+	}
+	for _, r := range i.LatLong {
+		if r.ContainsPosition(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// InLatLong reports whether the position lies within the LatLong filter of the command most recently sent with
+// InitWith, in the same way as InitCommand.InLatLong.
+func (c *Stream) InLatLong(p PositionMessage) bool {
+	cmd := InitCommand{LatLong: c.latLong}
+	return cmd.InLatLong(p)
+}
+
+// FilterPositions passes on the messages received from ch, dropping any position which does not lie within at least
+// one of the rectangles. Messages other than positions are passed on unchanged. The returned channel is closed once ch
+// is closed.
+//
+// This enforces a strict geographic boundary on the client, unlike the LatLong filter of the InitCommand, which keeps
+// sending positions for a flight after it leaves the rectangles.
+func FilterPositions(ch <-chan *Message, rects ...Rectangle) <-chan *Message {
+	out := make(chan *Message)
+	go func() {
+		defer close(out)
+		for msg := range ch {
+			if pos, ok := msg.Payload.(PositionMessage); ok && !anyContains(rects, pos) {
+				continue
+			}
+			out <- msg
+		}
+	}()
+	return out
+}
+
+func anyContains(rects []Rectangle, pos PositionMessage) bool {
+	for _, r := range rects {
+		if r.ContainsPosition(pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// Time returns the report time given by Clock. An error is returned if Clock is missing or malformed.
+func (p PositionMessage) Time() (time.Time, error) {
+	return parseEpoch(p.Clock)
+}
+
+// EstimatedArrival returns the estimated time of arrival given by ETA, if it is present and valid.
+func (p PositionMessage) EstimatedArrival() (time.Time, bool) {
+	return optionalEpoch(p.ETA)
+}
+
+// EstimatedDeparture returns the revised estimated departure time given by EDT, if it is present and valid.
+func (p PositionMessage) EstimatedDeparture() (time.Time, bool) {
+	return optionalEpoch(p.EDT)
+}
+
+// EnRoute returns the en route time given by ETE, if it is present and valid.
+func (p PositionMessage) EnRoute() (time.Duration, bool) {
+	secs, err := strconv.ParseInt(p.ETE, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// Time returns the time given by Clock, if it is present and valid.
+func (w Waypoint) Time() (time.Time, bool) {
+	return optionalEpoch(w.Clock)
+}
+
+// Altitude returns Alt in feet, if it is present and numeric.
+func (w Waypoint) Altitude() (int, bool) {
+	return optionalAltitude(w.Alt)
+}
+
+// GroundSpeed returns GS in knots, if it is present and numeric.
+func (w Waypoint) GroundSpeed() (float64, bool) {
+	return optionalFloat(w.GS)
+}
+
+// Coordinate returns the waypoint's latitude and longitude in decimal degrees.
+func (w Waypoint) Coordinate() (lat, lon float64) {
+	return w.Lat, w.Lon
+}
+
+// optionalEpoch parses an optional POSIX epoch field, reporting false if it is empty or malformed.
+func optionalEpoch(s string) (time.Time, bool) {
+	t, err := parseEpoch(s)
+	return t, err == nil
+}
+
+// CompactPosition is a reduced view of a PositionMessage holding only the fields most consumers need to plot an
+// aircraft.
+//
+// Firehose does not offer a lighter-weight position event, so the full PositionMessage is always received and decoded;
+// CompactPosition is derived from it on the client to reduce the memory held by consumers which retain many positions.
+type CompactPosition struct {
+	// ID is the FlightAware Flight ID.
+	ID string
+	// Ident is the callsign identifying the flight.
+	Ident string
+	// Lat is the latitude in decimal degrees.
+	Lat string
+	// Lon is the longitude in decimal degrees.
+	Lon string
+	// Alt is the altitude in feet (MSL).
+	Alt string
+	// Heading is the course in degrees.
+	Heading string
+	// GS is the ground speed in knots.
+	GS string
+	// Clock is the report time in POSIX epoch format.
+	Clock string
+}
+
+// Compact extracts a CompactPosition from the position.
+func (p PositionMessage) Compact() CompactPosition {
+	return CompactPosition{
+		ID:      p.ID,
+		Ident:   p.Ident,
+		Lat:     p.Lat,
+		Lon:     p.Lon,
+		Alt:     p.Alt,
+		Heading: p.Heading,
+		GS:      p.GS,
+		Clock:   p.Clock,
+	}
+}
@@ -0,0 +1,377 @@
+package firehose_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestPositionAltChangeAlias(t *testing.T) {
+	for _, data := range []string{
+		`{"type":"position","alt_change":"C"}`,
+		`{"type":"position","altChange":"C"}`,
+	} {
+		var pm firehose.PositionMessage
+		if err := json.Unmarshal([]byte(data), &pm); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		if pm.AltChange != "C" {
+			t.Errorf("unexpected alt change for %s: %q", data, pm.AltChange)
+		}
+	}
+}
+
+func TestPositionTrend(t *testing.T) {
+	tests := map[string]firehose.AltitudeTrend{
+		"C": firehose.TrendClimbing,
+		"D": firehose.TrendDescending,
+		" ": firehose.TrendLevel,
+		"":  firehose.TrendUnknown,
+		"X": firehose.TrendUnknown,
+	}
+	for code, expected := range tests {
+		pm := firehose.PositionMessage{AltChange: code}
+		if actual := pm.Trend(); actual != expected {
+			t.Errorf("expected %q to be %s, got %s", code, expected, actual)
+		}
+	}
+}
+
+func TestPositionCompact(t *testing.T) {
+	pm := firehose.PositionMessage{
+		ID:      "WSN145-1596063797-adhoc-0",
+		Ident:   "WSN145",
+		Lat:     "9.01767",
+		Lon:     "-79.42058",
+		Alt:     "1550",
+		Heading: "31",
+		GS:      "124",
+		Clock:   "1596067217",
+		Squawk:  "1261",
+	}
+	expected := firehose.CompactPosition{
+		ID:      "WSN145-1596063797-adhoc-0",
+		Ident:   "WSN145",
+		Lat:     "9.01767",
+		Lon:     "-79.42058",
+		Alt:     "1550",
+		Heading: "31",
+		GS:      "124",
+		Clock:   "1596067217",
+	}
+	if actual := pm.Compact(); actual != expected {
+		t.Errorf("unexpected compact position: %#v", actual)
+	}
+}
+
+func TestPositionEnums(t *testing.T) {
+	var pos firehose.PositionMessage
+	if err := json.Unmarshal([]byte(`{"type":"position","updateType":"M","air_ground":"G"}`), &pos); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if pos.UpdateType != firehose.UpdateTypeMLAT || pos.UpdateType.Description() != "multilateration" {
+		t.Errorf("unexpected update type: %q", pos.UpdateType)
+	}
+	if pos.AirGround != firehose.AirGroundGround || pos.AirGround.Description() != "ground" {
+		t.Errorf("unexpected air/ground: %q", pos.AirGround)
+	}
+
+	if u, err := firehose.ParseUpdateType("S"); err != nil || u != firehose.UpdateTypeSpaceADSB {
+		t.Errorf("unexpected result parsing update type: %q, %v", u, err)
+	}
+	if _, err := firehose.ParseUpdateType("Q"); err == nil {
+		t.Errorf("expected error parsing unknown update type")
+	}
+	if a, err := firehose.ParseAirGround("WOW"); err != nil || a != firehose.AirGroundWOW {
+		t.Errorf("unexpected result parsing air/ground: %q, %v", a, err)
+	}
+	if _, err := firehose.ParseAirGround(""); err == nil {
+		t.Errorf("expected error parsing empty air/ground")
+	}
+}
+
+func TestPositionTimes(t *testing.T) {
+	pos := firehose.PositionMessage{Clock: "1596067800", ETA: "1596090000", EDT: "", ETE: "3600"}
+	if at, err := pos.Time(); err != nil || !at.Equal(time.Unix(1596067800, 0)) {
+		t.Errorf("unexpected time: %v, %v", at, err)
+	}
+	if eta, ok := pos.EstimatedArrival(); !ok || !eta.Equal(time.Unix(1596090000, 0)) {
+		t.Errorf("unexpected estimated arrival: %v, %t", eta, ok)
+	}
+	if _, ok := pos.EstimatedDeparture(); ok {
+		t.Errorf("expected missing estimated departure")
+	}
+	if ete, ok := pos.EnRoute(); !ok || ete != time.Hour {
+		t.Errorf("unexpected en route time: %v, %t", ete, ok)
+	}
+
+	pos.Clock = ""
+	if _, err := pos.Time(); err == nil {
+		t.Errorf("expected error for missing clock")
+	}
+
+	if _, ok := (firehose.Waypoint{}).Time(); ok {
+		t.Errorf("expected missing waypoint time")
+	}
+	if at, ok := (firehose.Waypoint{Clock: "1596067800"}).Time(); !ok || at.Unix() != 1596067800 {
+		t.Errorf("unexpected waypoint time: %v, %t", at, ok)
+	}
+}
+
+func TestWaypointAccessors(t *testing.T) {
+	wp := firehose.Waypoint{Lat: 42.36, Lon: -71.01, Alt: "12000", GS: "250.5"}
+	if alt, ok := wp.Altitude(); !ok || alt != 12000 {
+		t.Errorf("unexpected altitude: %d, %t", alt, ok)
+	}
+	if gs, ok := wp.GroundSpeed(); !ok || gs != 250.5 {
+		t.Errorf("unexpected ground speed: %v, %t", gs, ok)
+	}
+	if lat, lon := wp.Coordinate(); lat != 42.36 || lon != -71.01 {
+		t.Errorf("unexpected coordinate: %v, %v", lat, lon)
+	}
+
+	var empty firehose.Waypoint
+	if _, ok := empty.Altitude(); ok {
+		t.Errorf("expected missing altitude")
+	}
+	if _, ok := empty.GroundSpeed(); ok {
+		t.Errorf("expected missing ground speed")
+	}
+}
+
+func TestPositionNumbers(t *testing.T) {
+	pos := firehose.PositionMessage{Lat: "42.36", Lon: "-71.01", Alt: "35000", GS: "450", Heading: "271.5"}
+	if pos.Latitude() != 42.36 || pos.Longitude() != -71.01 {
+		t.Errorf("unexpected coordinates: %v, %v", pos.Latitude(), pos.Longitude())
+	}
+	if alt, ok := pos.Altitude(); !ok || alt != 35000 {
+		t.Errorf("unexpected altitude: %d, %t", alt, ok)
+	}
+	if gs, ok := pos.GroundSpeed(); !ok || gs != 450 {
+		t.Errorf("unexpected ground speed: %v, %t", gs, ok)
+	}
+	if hdg, ok := pos.HeadingDeg(); !ok || hdg != 271.5 {
+		t.Errorf("unexpected heading: %v, %t", hdg, ok)
+	}
+
+	ground := firehose.PositionMessage{Alt: "ground"}
+	if _, ok := ground.Altitude(); ok {
+		t.Errorf("expected non-numeric altitude to be reported as not ok")
+	}
+	if _, ok := ground.GroundSpeed(); ok {
+		t.Errorf("expected missing ground speed to be reported as not ok")
+	}
+	if ground.Latitude() != 0 {
+		t.Errorf("expected zero latitude when missing")
+	}
+}
+
+func TestBestHeading(t *testing.T) {
+	for _, tc := range []struct {
+		pos firehose.PositionMessage
+		deg float64
+		ref firehose.HeadingRef
+		ok  bool
+	}{
+		{firehose.PositionMessage{Heading: "270", HeadingMagnetic: "265.5", HeadingTrue: "271"}, 271, firehose.HeadingTrue, true},
+		{firehose.PositionMessage{Heading: "270", HeadingMagnetic: "265.5"}, 265.5, firehose.HeadingMagnetic, true},
+		{firehose.PositionMessage{Heading: "270", HeadingTrue: "n/a"}, 270, firehose.HeadingUnknown, true},
+		{firehose.PositionMessage{}, 0, firehose.HeadingUnknown, false},
+	} {
+		deg, ref, ok := tc.pos.BestHeading()
+		if deg != tc.deg || ref != tc.ref || ok != tc.ok {
+			t.Errorf("expected %v, %s, %t for %+v, got %v, %s, %t", tc.deg, tc.ref, tc.ok, tc.pos, deg, ref, ok)
+		}
+	}
+}
+
+func TestVerticalRate(t *testing.T) {
+	for _, tc := range []struct {
+		pos    firehose.PositionMessage
+		fpm    float64
+		source firehose.VertRateSource
+		ok     bool
+	}{
+		{firehose.PositionMessage{VertRate: "-704", VertRateGeom: "-640"}, -640, firehose.VertRateGeometric, true},
+		{firehose.PositionMessage{VertRate: "1200", VertRateGeom: " "}, 1200, firehose.VertRateBarometric, true},
+		{firehose.PositionMessage{}, 0, firehose.VertRateNone, false},
+	} {
+		fpm, source, ok := tc.pos.VerticalRate()
+		if fpm != tc.fpm || source != tc.source || ok != tc.ok {
+			t.Errorf("expected %v, %s, %t for %+v, got %v, %s, %t", tc.fpm, tc.source, tc.ok, tc.pos, fpm, source, ok)
+		}
+	}
+}
+
+func TestWeather(t *testing.T) {
+	pos := firehose.PositionMessage{WindDir: "57", WindSpeed: "2", WindQuality: "1", Temperature: "-41.5", TemperatureQuality: "0"}
+	if dir, speed, reliable, ok := pos.Wind(); dir != 57 || speed != 2 || !reliable || !ok {
+		t.Errorf("unexpected wind: %v, %v, %t, %t", dir, speed, reliable, ok)
+	}
+	if celsius, reliable, ok := pos.OutsideAirTemp(); celsius != -41.5 || reliable || !ok {
+		t.Errorf("unexpected temperature: %v, %t, %t", celsius, reliable, ok)
+	}
+
+	pos = firehose.PositionMessage{WindDir: "57", WindQuality: "1"}
+	if _, _, _, ok := pos.Wind(); ok {
+		t.Errorf("expected wind without a speed not to be ok")
+	}
+	if _, _, ok := pos.OutsideAirTemp(); ok {
+		t.Errorf("expected a missing temperature not to be ok")
+	}
+}
+
+func TestSquawk(t *testing.T) {
+	for _, tc := range []struct {
+		squawk    string
+		code      string
+		ok        bool
+		emergency firehose.EmergencyType
+	}{
+		{"1261", "1261", true, firehose.EmergencyNone},
+		{"7500", "7500", true, firehose.EmergencyHijack},
+		{"7600", "7600", true, firehose.EmergencyRadioFailure},
+		{" 7700", "7700", true, firehose.EmergencyGeneral},
+		{"7800", "", false, firehose.EmergencyNone},
+		{"770", "", false, firehose.EmergencyNone},
+		{"", "", false, firehose.EmergencyNone},
+	} {
+		pos := firehose.PositionMessage{Squawk: tc.squawk}
+		if code, ok := pos.SquawkCode(); code != tc.code || ok != tc.ok {
+			t.Errorf("expected SquawkCode of %q to be %q, %t, got %q, %t", tc.squawk, tc.code, tc.ok, code, ok)
+		}
+		emergency, ok := pos.Emergency()
+		if emergency != tc.emergency || ok != (tc.emergency != firehose.EmergencyNone) {
+			t.Errorf("expected Emergency of %q to be %s, got %s, %t", tc.squawk, tc.emergency, emergency, ok)
+		}
+	}
+}
+
+func TestPositionFuel(t *testing.T) {
+	pos := firehose.PositionMessage{FuelOnBoard: "1000", FuelOnBoardUnit: firehose.FuelPounds}
+	if amount, unit, ok := pos.Fuel(); !ok || amount != 1000 || unit != firehose.FuelPounds {
+		t.Errorf("unexpected fuel: %v %s %t", amount, unit, ok)
+	}
+	if kg, ok := pos.FuelKilograms(); !ok || kg != 453.59237 {
+		t.Errorf("unexpected fuel mass: %v %t", kg, ok)
+	}
+
+	pos = firehose.PositionMessage{FuelOnBoard: "500", FuelOnBoardUnit: firehose.FuelGallons}
+	if _, ok := pos.FuelKilograms(); ok {
+		t.Errorf("expected volume not to be converted to mass")
+	}
+
+	pos = firehose.PositionMessage{FuelOnBoard: "500"}
+	if _, unit, ok := pos.Fuel(); !ok || unit != firehose.FuelUnknown {
+		t.Errorf("expected missing unit to be reported as unknown, got %s %t", unit, ok)
+	}
+
+	if _, _, ok := (firehose.PositionMessage{}).Fuel(); ok {
+		t.Errorf("expected missing fuel to be reported as not ok")
+	}
+}
+
+func TestFilterPositions(t *testing.T) {
+	boston := firehose.Rectangle{LowLat: 42, LowLon: -72, HiLat: 43, HiLon: -70}
+	if (boston.ContainsPosition(firehose.PositionMessage{})) {
+		t.Errorf("position without coordinates should not be contained")
+	}
+
+	in := make(chan *firehose.Message)
+	go func() {
+		defer close(in)
+		in <- &firehose.Message{Type: "position", Payload: firehose.PositionMessage{Ident: "IN", Lat: "42.36", Lon: "-71.01"}}
+		in <- &firehose.Message{Type: "position", Payload: firehose.PositionMessage{Ident: "OUT", Lat: "37.62", Lon: "-122.38"}}
+		in <- &firehose.Message{Type: "keepalive", Payload: firehose.KeepaliveMessage{}}
+	}()
+
+	var types []string
+	for msg := range firehose.FilterPositions(in, boston) {
+		if pos, ok := msg.Payload.(firehose.PositionMessage); ok {
+			types = append(types, pos.Ident)
+		} else {
+			types = append(types, msg.Type)
+		}
+	}
+	if len(types) != 2 || types[0] != "IN" || types[1] != "keepalive" {
+		t.Errorf("unexpected filtered messages: %v", types)
+	}
+}
+
+func TestInLatLong(t *testing.T) {
+	cmd := firehose.InitCommand{LatLong: []firehose.Rectangle{
+		{LowLat: 42, LowLon: -72, HiLat: 43, HiLon: -70},
+		{LowLat: 50, LowLon: 170, HiLat: 55, HiLon: -170},
+	}}
+	for _, tc := range []struct {
+		pos firehose.PositionMessage
+		in  bool
+	}{
+		{firehose.PositionMessage{Lat: "42.36", Lon: "-71.01"}, true},
+		{firehose.PositionMessage{Lat: "52", Lon: "179.5"}, true},
+		{firehose.PositionMessage{Lat: "40.64", Lon: "-73.78"}, false},
+		{firehose.PositionMessage{}, false},
+	} {
+		if in := cmd.InLatLong(tc.pos); in != tc.in {
+			t.Errorf("expected InLatLong to be %t for %s, %s", tc.in, tc.pos.Lat, tc.pos.Lon)
+		}
+	}
+
+	stream, server := pipeStream(t)
+	jfk := firehose.PositionMessage{Lat: "40.64", Lon: "-73.78"}
+	if !stream.InLatLong(jfk) {
+		t.Errorf("expected every position to be inside without a LatLong filter")
+	}
+	go bufio.NewReader(server).ReadString('\n')
+	cmd.Live, cmd.Username, cmd.Password = true, "un", "pw"
+	if err := stream.InitWith(context.Background(), cmd); err != nil {
+		t.Fatalf("could not send init command: %v", err)
+	}
+	if stream.InLatLong(jfk) {
+		t.Errorf("expected the position to be outside the LatLong filter sent to the stream")
+	}
+}
+
+func TestPositionQuality(t *testing.T) {
+	pos := firehose.PositionMessage{NACp: 9, NACv: 1, NIC: 8, NICBaro: 1, SIL: 3, SILType: "perhour", PosRC: 185.2}
+	q := pos.Quality()
+	if q.NACp != 9 || q.NIC != 8 || q.SILType != "perhour" || q.PosRC != 185.2 {
+		t.Errorf("unexpected quality: %+v", q)
+	}
+	if !q.IsHighIntegrity() {
+		t.Errorf("expected %+v to be high integrity", q)
+	}
+
+	q.SIL = 2
+	if q.IsHighIntegrity() {
+		t.Errorf("expected insufficient SIL not to be high integrity")
+	}
+	if (firehose.PositionMessage{}).Quality().IsHighIntegrity() {
+		t.Errorf("expected unknown categories not to be high integrity")
+	}
+}
+
+func TestPositionIdentity(t *testing.T) {
+	for _, tc := range []struct {
+		pos  firehose.PositionMessage
+		want firehose.Identity
+		name string
+	}{
+		{firehose.PositionMessage{Ident: "UAL123", ATCIdent: "UAL123", Reg: "N12345"}, firehose.Identity{Callsign: "UAL123", Registration: "N12345"}, "UAL123"},
+		{firehose.PositionMessage{Ident: "N12345", Reg: "N12345"}, firehose.Identity{Callsign: "N12345"}, "N12345"},
+		{firehose.PositionMessage{ATCIdent: "GAA12", Reg: "N54321"}, firehose.Identity{ATCIdent: "GAA12", Registration: "N54321"}, "N54321"},
+		{firehose.PositionMessage{ATCIdent: "GAA12"}, firehose.Identity{ATCIdent: "GAA12"}, "GAA12"},
+		{firehose.PositionMessage{}, firehose.Identity{}, ""},
+	} {
+		if got := tc.pos.Identity(); got != tc.want {
+			t.Errorf("Identity() = %+v, want %+v", got, tc.want)
+		}
+		if got := tc.pos.DisplayName(); got != tc.name {
+			t.Errorf("DisplayName() = %q, want %q", got, tc.name)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package firehose
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// dialTLSViaProxy connects to addr through the proxy at proxyURL and performs the TLS handshake with addr over the
+// tunnel, so that the server's certificate is verified against addr rather than the proxy.
+func dialTLSViaProxy(ctx context.Context, d *net.Dialer, config *tls.Config, proxyURL, addr string) (net.Conn, error) {
+	if d.Timeout > 0 {
+		// As with tls.Dialer, the timeout covers the whole connection, including the handshakes.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	conn, err := dialProxy(ctx, d, proxyURL, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config = cloneConfig(config)
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dialProxy opens a TCP connection to the proxy at proxyURL and asks it to connect to addr, returning the tunnel.
+// SOCKS5 proxies are supported with the socks5 and socks5h schemes, and HTTP proxies using CONNECT with the http
+// scheme. Credentials are taken from the URL's user information.
+func dialProxy(ctx context.Context, d *net.Dialer, proxyURL, addr string) (net.Conn, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	var connect func(net.Conn, *url.Userinfo, string) (net.Conn, error)
+	var defaultPort string
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		connect, defaultPort = socks5Connect, "1080"
+	case "http":
+		connect, defaultPort = httpConnect, "80"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		proxyAddr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to proxy: %w", err)
+	}
+	defer interruptOnDone(ctx, conn.SetDeadline)()
+	tunnel, err := connect(conn, u.User, addr)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("proxy could not connect to %s: %w", addr, err)
+	}
+	return tunnel, nil
+}
+
+// socks5Connect asks the SOCKS5 proxy on conn to connect to addr, as described by RFC 1928, authenticating with the
+// username and password of user, if any, as described by RFC 1929. The host name is resolved by the proxy.
+func socks5Connect(conn net.Conn, user *url.Userinfo, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	const noAuth, passwordAuth, noAcceptable = 0x00, 0x02, 0xff
+	greeting := []byte{5, 1, noAuth}
+	if user != nil {
+		greeting = []byte{5, 2, noAuth, passwordAuth}
+	}
+	if _, err := conn.Write(greeting); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	if reply[0] != 5 {
+		return nil, fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+	switch reply[1] {
+	case noAuth:
+	case passwordAuth:
+		if user == nil {
+			return nil, errors.New("SOCKS proxy requires a username and password")
+		}
+		password, _ := user.Password()
+		if len(user.Username()) > 255 || len(password) > 255 {
+			return nil, errors.New("SOCKS username or password is too long")
+		}
+		auth := []byte{1, byte(len(user.Username()))}
+		auth = append(auth, user.Username()...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, err
+		}
+		if reply[1] != 0 {
+			return nil, errors.New("SOCKS proxy rejected the username and password")
+		}
+	case noAcceptable:
+		return nil, errors.New("SOCKS proxy accepted none of the offered authentication methods")
+	default:
+		return nil, fmt.Errorf("SOCKS proxy chose unsupported authentication method %d", reply[1])
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip.To4() != nil {
+		req = append(append(req, 1), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 4), ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return nil, errors.New("host name is too long for SOCKS")
+		}
+		req = append(append(req, 3, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	// The reply holds the version, a status, a reserved byte, and the address bound by the proxy, which is not needed.
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return nil, err
+	}
+	if head[1] != 0 {
+		return nil, fmt.Errorf("SOCKS proxy refused the connection with status %d", head[1])
+	}
+	var skip int
+	switch head[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(conn, head[:1]); err != nil {
+			return nil, err
+		}
+		skip = int(head[0])
+	default:
+		return nil, fmt.Errorf("SOCKS proxy replied with unknown address type %d", head[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// httpConnect asks the HTTP proxy on conn to open a tunnel to addr with the CONNECT method, authenticating with basic
+// authentication if user is set.
+func httpConnect(conn net.Conn, user *url.Userinfo, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP proxy responded %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// Anything the proxy sent after its response belongs to the tunnel.
+		return bufferedConn{conn, br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads are served from a buffer which may already hold data read from it.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,151 @@
+package firehose_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/benburwell/firehose"
+	"github.com/benburwell/firehose/firehosetest"
+)
+
+// startProxy runs a proxy on the loopback interface which accepts a single connection, negotiates a tunnel with
+// handshake, and then relays the connection to upstream whatever target was requested. The target is sent on the
+// returned channel.
+func startProxy(t *testing.T, upstream string, handshake func(*bufio.ReadWriter) (string, error)) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	targets := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+		target, err := handshake(rw)
+		if err != nil {
+			t.Errorf("proxy handshake failed: %v", err)
+			return
+		}
+		targets <- target
+		up, err := net.Dial("tcp", upstream)
+		if err != nil {
+			return
+		}
+		defer up.Close()
+		go io.Copy(up, rw)
+		io.Copy(conn, up)
+	}()
+	return ln.Addr().String(), targets
+}
+
+// socks5Handshake accepts a SOCKS5 CONNECT with username and password authentication.
+func socks5Handshake(rw *bufio.ReadWriter) (string, error) {
+	head := make([]byte, 2)
+	io.ReadFull(rw, head)
+	io.ReadFull(rw, make([]byte, head[1]))
+	rw.Write([]byte{5, 2})
+	rw.Flush()
+
+	io.ReadFull(rw, head)
+	user := make([]byte, head[1])
+	io.ReadFull(rw, user)
+	n, _ := rw.ReadByte()
+	pass := make([]byte, n)
+	io.ReadFull(rw, pass)
+	if string(user) != "un" || string(pass) != "pw" {
+		rw.Write([]byte{1, 1})
+		rw.Flush()
+		return "", io.ErrUnexpectedEOF
+	}
+	rw.Write([]byte{1, 0})
+	rw.Flush()
+
+	req := make([]byte, 5)
+	io.ReadFull(rw, req)
+	host := make([]byte, req[4])
+	io.ReadFull(rw, host)
+	port := make([]byte, 2)
+	io.ReadFull(rw, port)
+	rw.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	rw.Flush()
+	return net.JoinHostPort(string(host), strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// connectHandshake accepts an HTTP CONNECT request.
+func connectHandshake(rw *bufio.ReadWriter) (string, error) {
+	req, err := http.ReadRequest(rw.Reader)
+	if err != nil {
+		return "", err
+	}
+	rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+	rw.Flush()
+	return req.Host, nil
+}
+
+func TestProxy(t *testing.T) {
+	srv := firehosetest.NewServer(`{"type":"keepalive","serverTime":"1"}`)
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Addr)
+	target := net.JoinHostPort("localhost", port)
+
+	for name, tc := range map[string]struct {
+		handshake func(*bufio.ReadWriter) (string, error)
+		url       func(addr string) string
+	}{
+		"socks5": {socks5Handshake, func(addr string) string { return "socks5://un:pw@" + addr }},
+		"http":   {connectHandshake, func(addr string) string { return "http://" + addr }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			proxyAddr, targets := startProxy(t, srv.Addr, tc.handshake)
+			opts := append(srv.Options(), firehose.WithAddress(target), firehose.WithProxy(tc.url(proxyAddr)))
+			stream, err := firehose.Dial(context.Background(), opts...)
+			if err != nil {
+				t.Fatalf("could not connect through proxy: %v", err)
+			}
+			defer stream.Close()
+			if got := <-targets; got != target {
+				t.Errorf("expected the proxy to be asked for %s, got %s", target, got)
+			}
+			if err := stream.InitWith(context.Background(), firehose.InitCommand{Live: true, Username: "un", Password: "pw"}); err != nil {
+				t.Fatalf("could not send init command: %v", err)
+			}
+			if _, err := stream.NextMessage(context.Background()); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestProxyVerifiesServer(t *testing.T) {
+	srv := firehosetest.NewServer()
+	defer srv.Close()
+
+	// The server's certificate is for localhost, so a connection to another host must fail verification even though
+	// the proxy relays it to the server.
+	proxyAddr, _ := startProxy(t, srv.Addr, connectHandshake)
+	opts := append(srv.Options(), firehose.WithAddress("firehose.invalid:1501"), firehose.WithProxy("http://"+proxyAddr))
+	stream, err := firehose.Dial(context.Background(), opts...)
+	var verr *tls.CertificateVerificationError
+	if !errors.As(err, &verr) {
+		t.Errorf("expected certificate verification to fail for the wrong host, got: %v", err)
+	}
+	if err == nil {
+		stream.Close()
+	}
+
+	if _, err := firehose.Dial(context.Background(), append(srv.Options(), firehose.WithProxy("ftp://proxy"))...); err == nil {
+		t.Errorf("expected an error for an unsupported proxy scheme")
+	}
+}
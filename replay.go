@@ -0,0 +1,132 @@
+package firehose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// A Recorder archives messages as newline-delimited JSON, in the same framing that Firehose uses on the wire, so that
+// the archive can later be played back with NewReader or ResumeStream.
+//
+// Every message type which carries a PITR includes it in its serialized form, so a replay of the archive always knows
+// the PITR of the last message it emitted.
+//
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder creates a Recorder which writes to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Record appends msg to the archive.
+func (r *Recorder) Record(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(data)
+	return err
+}
+
+// A ResumingStream plays back an archive of recorded messages and then switches to live data from a connection,
+// giving uninterrupted history followed by the live feed.
+type ResumingStream struct {
+	replay *Stream
+	conn   net.Conn
+	cmd    InitCommand
+	opts   []Option
+	live   *Stream
+}
+
+// ResumeStream creates a ResumingStream which first returns every message in archive and then continues with
+// messages from conn.
+//
+// Once the archive is exhausted, the init command is sent over conn with Stream.InitWith, so it is validated and its
+// client-side filters apply to the live data. If any archived message carried a PITR, cmd is modified to resume from
+// the PITR of the last such message: the start of its Range is moved to that PITR if a Range is set, and otherwise
+// PITR is set and Live is cleared. An archive without any PITR leaves cmd unchanged.
+//
+// Since a PITR has a resolution of one second, the server replays every message from that second onwards, so a few
+// messages at the boundary between the archive and the live data may be delivered twice. Consumers which cannot
+// tolerate duplicates should filter them out.
+//
+// The options are applied to the live Stream; they also apply to the playback of the archive, except for
+// WithCompression.
+func ResumeStream(archive io.Reader, conn net.Conn, cmd InitCommand, opts ...Option) *ResumingStream {
+	replayOpts := append(append([]Option(nil), opts...), WithCompression(CompressionNone))
+	return &ResumingStream{
+		replay: NewReader(archive, replayOpts...),
+		conn:   conn,
+		cmd:    cmd,
+		opts:   opts,
+	}
+}
+
+// NextMessage returns the next message from the archive or, once it is exhausted, from the live connection.
+func (r *ResumingStream) NextMessage(ctx context.Context) (*Message, error) {
+	if r.live == nil {
+		msg, err := r.replay.NextMessage(ctx)
+		if !errors.Is(err, io.EOF) {
+			return msg, err
+		}
+		if err := r.handoff(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return r.live.NextMessage(ctx)
+}
+
+// handoff starts the live stream from the PITR at which the archive ended.
+func (r *ResumingStream) handoff(ctx context.Context) error {
+	cmd := resumeCommand(r.cmd, r.replay.PITR())
+	live := NewStream(r.conn, r.opts...)
+	if err := live.InitWith(ctx, cmd); err != nil {
+		return err
+	}
+	r.live = live
+	return nil
+}
+
+// PITR returns the PITR of the most recent message returned by NextMessage which carried one.
+func (r *ResumingStream) PITR() string {
+	if r.live != nil {
+		if pitr := r.live.PITR(); pitr != "" {
+			return pitr
+		}
+	}
+	return r.replay.PITR()
+}
+
+// Close closes the live connection, and the archive if it implements io.Closer.
+func (r *ResumingStream) Close() error {
+	return errors.Join(r.replay.Close(), r.conn.Close())
+}
+
+// resumeCommand returns a copy of cmd modified to resume from pitr. If a Range is set its start is moved to pitr;
+// otherwise PITR is set and Live is cleared. An empty pitr leaves cmd unchanged.
+func resumeCommand(cmd InitCommand, pitr string) InitCommand {
+	if pitr == "" {
+		return cmd
+	}
+	if cmd.Range != nil {
+		rng := *cmd.Range
+		rng.Start = pitr
+		cmd.Range = &rng
+	} else {
+		cmd.Live = false
+		cmd.PITR = pitr
+	}
+	return cmd
+}
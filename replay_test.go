@@ -0,0 +1,209 @@
+package firehose_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestRecorder(t *testing.T) {
+	var archive bytes.Buffer
+	rec := firehose.NewRecorder(&archive)
+	pitrs := []string{"1001", "1002"}
+	for _, pitr := range pitrs {
+		msg := &firehose.Message{
+			Type:    "position",
+			Payload: firehose.PositionMessage{Type: "position", Ident: "WSN145", PITR: pitr},
+		}
+		if err := rec.Record(msg); err != nil {
+			t.Fatalf("could not record message: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(archive.String(), "\n"), "\n")
+	if len(lines) != len(pitrs) {
+		t.Fatalf("expected %d archived lines, got %d: %q", len(pitrs), len(lines), archive.String())
+	}
+	for i, line := range lines {
+		var msg firehose.Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("could not decode archived message: %v", err)
+		}
+		if pos, ok := msg.Payload.(firehose.PositionMessage); !ok || pos.Ident != "WSN145" || msg.PITR != pitrs[i] {
+			t.Errorf("unexpected archived message: %#v", msg)
+		}
+	}
+}
+
+func TestRecorderReplay(t *testing.T) {
+	var archive bytes.Buffer
+	rec := firehose.NewRecorder(&archive)
+	for _, pitr := range []string{"1001", "1002"} {
+		msg := &firehose.Message{
+			Type:    "position",
+			Payload: firehose.PositionMessage{Type: "position", Ident: "WSN145", PITR: pitr},
+		}
+		if err := rec.Record(msg); err != nil {
+			t.Fatalf("could not record message: %v", err)
+		}
+	}
+
+	replay := firehose.NewReader(&archive)
+	if err := replay.Init("live"); !errors.Is(err, firehose.ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected from Init, got: %v", err)
+	}
+	for _, pitr := range []string{"1001", "1002"} {
+		msg, err := replay.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected replay error: %v", err)
+		}
+		if pos := msg.Payload.(firehose.PositionMessage); pos.Ident != "WSN145" || pos.PITR != pitr {
+			t.Errorf("unexpected replayed position: %#v", pos)
+		}
+		if replay.PITR() != pitr {
+			t.Errorf("expected replay PITR %s, got %s", pitr, replay.PITR())
+		}
+	}
+	if _, err := replay.NextMessage(context.Background()); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF at end of archive, got: %v", err)
+	}
+}
+
+func TestResumeStream(t *testing.T) {
+	archive := strings.NewReader(`{"type":"position","ident":"OLD1","pitr":"1001"}
+{"type":"position","ident":"OLD2","pitr":"1002"}
+`)
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	initc := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(server).ReadString('\n')
+		initc <- line
+		fmt.Fprintln(server, `{"type":"position","ident":"NEW1","pitr":"1003"}`)
+	}()
+
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	stream := firehose.ResumeStream(archive, client, cmd)
+	for _, ident := range []string{"OLD1", "OLD2", "NEW1"} {
+		msg, err := stream.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pos := msg.Payload.(firehose.PositionMessage); pos.Ident != ident {
+			t.Errorf("expected %s, got %s", ident, pos.Ident)
+		}
+	}
+	if line := <-initc; !strings.HasPrefix(line, "pitr 1002 ") {
+		t.Errorf("expected live stream to resume from the last archived PITR, got: %q", line)
+	}
+	if stream.PITR() != "1003" {
+		t.Errorf("unexpected PITR after handoff: %s", stream.PITR())
+	}
+}
+
+func TestResumeStreamFilters(t *testing.T) {
+	archive := strings.NewReader(`{"type":"position","ident":"OLD1","alt":"35000","pitr":"1001"}` + "\n")
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	go func() {
+		bufio.NewReader(server).ReadString('\n')
+		fmt.Fprintln(server, `{"type":"position","ident":"LOW","alt":"2000","pitr":"1002"}`)
+		fmt.Fprintln(server, `{"type":"position","ident":"HIGH","alt":"36000","pitr":"1003"}`)
+	}()
+
+	// The client-side filters of the init command apply to the live data as well.
+	cmd := firehose.InitCommand{
+		Live:           true,
+		Username:       "un",
+		Password:       "pw",
+		AltitudeFilter: &firehose.AltitudeRange{Min: 30000},
+	}
+	stream := firehose.ResumeStream(archive, client, cmd)
+	for _, ident := range []string{"OLD1", "HIGH"} {
+		msg, err := stream.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pos := msg.Payload.(firehose.PositionMessage); pos.Ident != ident {
+			t.Errorf("expected %s, got %s", ident, pos.Ident)
+		}
+	}
+
+	// An invalid init command is reported when the archive is exhausted, without being sent.
+	stream = firehose.ResumeStream(strings.NewReader(""), client, firehose.InitCommand{Live: true})
+	if _, err := stream.NextMessage(context.Background()); !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand at handoff, got: %v", err)
+	}
+}
+
+func TestReaderMessages(t *testing.T) {
+	stream := firehose.NewReader(strings.NewReader(`{"type":"position","ident":"A"}
+{"type":"keepalive","serverTime":"1"}
+{"type":"position","ident":"B"}
+`))
+	var types []string
+	for msg := range stream.Messages(context.Background()) {
+		types = append(types, msg.Type)
+	}
+	if strings.Join(types, " ") != "position keepalive position" {
+		t.Errorf("unexpected messages: %v", types)
+	}
+	if err := stream.Err(); err != nil {
+		t.Errorf("unexpected error at end of input: %v", err)
+	}
+
+	stream = firehose.NewReader(strings.NewReader("not json\n"))
+	for range stream.Messages(context.Background()) {
+		t.Errorf("unexpected message from malformed input")
+	}
+	if stream.Err() == nil {
+		t.Errorf("expected decoding error from Err")
+	}
+}
+
+func TestTee(t *testing.T) {
+	var recording bytes.Buffer
+	stream, server := pipeStream(t, firehose.WithTee(&recording))
+	lines := []string{
+		`{"type":"position","ident":"A","pitr":"1001"}`,
+		`{"type":"keepalive","serverTime":"1","pitr":"1002"}`,
+	}
+	serve(server, lines...)
+	for range lines {
+		if _, err := stream.NextMessage(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("unexpected error closing stream: %v", err)
+	}
+	if recording.String() != strings.Join(lines, "\n")+"\n" {
+		t.Fatalf("unexpected recording: %q", recording.String())
+	}
+
+	replay := firehose.NewReader(&recording)
+	for _, pitr := range []string{"1001", "1002"} {
+		msg, err := replay.NextMessage(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected replay error: %v", err)
+		}
+		if msg.PITR != pitr {
+			t.Errorf("expected PITR %s, got %s", pitr, msg.PITR)
+		}
+	}
+}
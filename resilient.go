@@ -0,0 +1,147 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A ResilientStream consumes Firehose across disconnections, reconnecting and resuming from the PITR of the last
+// message it delivered.
+//
+// The zero value is not usable; at least Command must be set. A ResilientStream must not be run more than once at a
+// time.
+type ResilientStream struct {
+	// Command is the init command sent on the first connection. Each reconnection sends a copy modified to resume from
+	// the last PITR seen, in the same way as ResumeStream.
+	Command InitCommand
+
+	// Options are passed to Dial when opening each connection.
+	Options []Option
+
+	// Dial opens a new Stream, without sending an init command. If nil, the package-level Dial is called with Options.
+	Dial func(ctx context.Context) (*Stream, error)
+
+	// Backoff decides how long to wait before each reconnection attempt. The attempts are counted from 1, and the count
+	// is reset, calling Backoff.Reset, once a connection delivers a message. If nil, DefaultBackoff is used. A plain
+	// function can be used with BackoffFunc.
+	Backoff Backoff
+
+	pitr string
+}
+
+// Run connects to Firehose and calls handler with every message received until ctx is done or a fatal error occurs.
+//
+// When a connection fails, Run waits according to Backoff and then reconnects, resuming from the PITR of the last
+// message for which handler returned successfully. Errors which cannot be resolved by reconnecting, as determined by
+// IsRetryable, are returned instead, as is any error returned by handler. Oversized messages are skipped without
+// reconnecting.
+//
+// If Command requests a Range, Run returns nil once the server reports that the range is complete by closing the
+// connection; see ErrRangeComplete.
+func (r *ResilientStream) Run(ctx context.Context, handler func(*Message) error) error {
+	if err := r.Command.Validate(); err != nil {
+		return err
+	}
+
+	logger := newOptions(r.Options).logger
+	var backoff Backoff = r.Backoff
+	if backoff == nil {
+		backoff = DefaultBackoff()
+	}
+	attempt := 0
+	for {
+		delivered, err := r.session(ctx, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var he handlerError
+		if errors.As(err, &he) {
+			return he.err
+		}
+		if errors.Is(err, ErrRangeComplete) || r.rangeComplete() {
+			return nil
+		}
+		if !IsRetryable(err) {
+			return err
+		}
+
+		if delivered {
+			attempt = 0
+			backoff.Reset()
+		}
+		attempt++
+		delay := backoff.Next(attempt)
+		logger.Info("reconnecting to firehose", "attempt", attempt, "delay", delay, "pitr", r.pitr, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// PITR returns the PITR of the last message successfully handled by Run.
+func (r *ResilientStream) PITR() string {
+	return r.pitr
+}
+
+// session runs a single connection until it fails, reporting whether any message was delivered to handler.
+func (r *ResilientStream) session(ctx context.Context, handler func(*Message) error) (bool, error) {
+	dial := r.Dial
+	if dial == nil {
+		dial = func(ctx context.Context) (*Stream, error) {
+			return Dial(ctx, r.Options...)
+		}
+	}
+	stream, err := dial(ctx)
+	if err != nil {
+		return false, fmt.Errorf("could not connect: %w", err)
+	}
+	defer stream.Close()
+
+	if err := stream.InitWith(ctx, resumeCommand(r.Command, r.pitr)); err != nil {
+		return false, fmt.Errorf("could not send init command: %w", err)
+	}
+
+	delivered := false
+	for {
+		msg, err := stream.NextMessage(ctx)
+		if errors.Is(err, ErrMessageTooLarge) {
+			continue
+		}
+		if err != nil {
+			return delivered, err
+		}
+		if err := handler(msg); err != nil {
+			return delivered, handlerError{err}
+		}
+		delivered = true
+		if msg.PITR != "" {
+			r.pitr = msg.PITR
+		}
+	}
+}
+
+// rangeComplete reports whether the last PITR seen has reached the end of the requested range.
+func (r *ResilientStream) rangeComplete() bool {
+	if r.Command.Range == nil || r.pitr == "" {
+		return false
+	}
+	end, err := parseEpoch(r.Command.Range.End)
+	if err != nil {
+		return false
+	}
+	last, err := parseEpoch(r.pitr)
+	return err == nil && !last.Before(end)
+}
+
+// handlerError marks an error returned by a ResilientStream's handler, so that it is passed through unchanged.
+type handlerError struct {
+	err error
+}
+
+func (e handlerError) Error() string { return e.err.Error() }
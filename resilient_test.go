@@ -0,0 +1,127 @@
+package firehose_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+// fakeServer hands out one scripted connection per dial, recording the init command received on each.
+type fakeServer struct {
+	t        *testing.T
+	sessions [][]string
+	inits    chan string
+}
+
+func (s *fakeServer) dial(ctx context.Context) (*firehose.Stream, error) {
+	if len(s.sessions) == 0 {
+		return nil, errors.New("no more sessions")
+	}
+	lines := s.sessions[0]
+	s.sessions = s.sessions[1:]
+	client, server := net.Pipe()
+	s.t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	go func() {
+		defer server.Close()
+		init, err := bufio.NewReader(server).ReadString('\n')
+		if err != nil {
+			return
+		}
+		s.inits <- init
+		for _, line := range lines {
+			if _, err := server.Write([]byte(line + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+	return firehose.NewStream(client), nil
+}
+
+func TestResilientStreamReconnects(t *testing.T) {
+	srv := &fakeServer{
+		t:     t,
+		inits: make(chan string, 3),
+		sessions: [][]string{
+			{`{"type":"position","ident":"A","pitr":"1001"}`},
+			{`{"type":"position","ident":"B","pitr":"1002"}`},
+			{`{"type":"error","error_msg":"Invalid username or password"}`},
+		},
+	}
+	rs := &firehose.ResilientStream{
+		Command: firehose.InitCommand{Live: true, Username: "user", Password: "pass"},
+		Dial:    srv.dial,
+		Backoff: firehose.BackoffFunc(func(int) time.Duration { return 0 }),
+	}
+
+	var idents []string
+	err := rs.Run(context.Background(), func(msg *firehose.Message) error {
+		idents = append(idents, msg.Payload.(firehose.PositionMessage).Ident)
+		return nil
+	})
+	if !errors.Is(err, firehose.ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got: %v", err)
+	}
+	if len(idents) != 2 || idents[0] != "A" || idents[1] != "B" {
+		t.Errorf("unexpected messages handled: %v", idents)
+	}
+	if rs.PITR() != "1002" {
+		t.Errorf("unexpected PITR: %s", rs.PITR())
+	}
+
+	for _, want := range []string{
+		`live username "user" password "pass"` + "\n",
+		`pitr 1001 username "user" password "pass"` + "\n",
+		`pitr 1002 username "user" password "pass"` + "\n",
+	} {
+		if got := <-srv.inits; got != want {
+			t.Errorf("expected init command %q, got %q", want, got)
+		}
+	}
+}
+
+func TestResilientStreamHandlerError(t *testing.T) {
+	srv := &fakeServer{
+		t:        t,
+		inits:    make(chan string, 1),
+		sessions: [][]string{{`{"type":"position","ident":"A","pitr":"1001"}`}},
+	}
+	rs := &firehose.ResilientStream{
+		Command: firehose.InitCommand{Live: true, Username: "user", Password: "pass"},
+		Dial:    srv.dial,
+	}
+	stop := errors.New("stop")
+	err := rs.Run(context.Background(), func(*firehose.Message) error { return stop })
+	if err != stop {
+		t.Errorf("expected handler error, got: %v", err)
+	}
+	if rs.PITR() != "" {
+		t.Errorf("PITR should not advance past a failed message, got: %s", rs.PITR())
+	}
+}
+
+func TestResilientStreamRangeComplete(t *testing.T) {
+	srv := &fakeServer{
+		t:        t,
+		inits:    make(chan string, 1),
+		sessions: [][]string{{`{"type":"position","ident":"A","pitr":"1001"}`}},
+	}
+	rs := &firehose.ResilientStream{
+		Command: firehose.InitCommand{
+			Range:    &firehose.PITRRange{Start: "1000", End: "2000"},
+			Username: "user",
+			Password: "pass",
+		},
+		Dial: srv.dial,
+	}
+	if err := rs.Run(context.Background(), func(*firehose.Message) error { return nil }); err != nil {
+		t.Errorf("expected range to complete, got: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package firehose
+
+import (
+	"strconv"
+	"strings"
+)
+
+// RouteElementKind classifies an element of a textual route.
+type RouteElementKind int
+
+const (
+	// RouteUnknown indicates an element which could not be classified.
+	RouteUnknown RouteElementKind = iota
+	// RouteAirport indicates a four-letter ICAO airport code, such as "KBOS".
+	RouteAirport
+	// RouteNavaid indicates a two- or three-letter navaid identifier, such as "BOS".
+	RouteNavaid
+	// RouteFix indicates a five-letter fix or intersection name, such as "MERIT".
+	RouteFix
+	// RouteAirway indicates an airway designator, such as "J75" or "UL9".
+	RouteAirway
+	// RouteProcedure indicates a departure or arrival procedure, such as "MERIT5" or "ROBUC3".
+	RouteProcedure
+	// RouteCoordinate indicates a latitude and longitude, given either in the form "L 9.13179 -81.43443" used by
+	// Firehose or in degrees and minutes, such as "4230N07100W".
+	RouteCoordinate
+	// RouteDirect indicates "DCT", a direct leg between the surrounding elements.
+	RouteDirect
+)
+
+// String returns a human-readable name for the kind.
+func (k RouteElementKind) String() string {
+	switch k {
+	case RouteAirport:
+		return "airport"
+	case RouteNavaid:
+		return "navaid"
+	case RouteFix:
+		return "fix"
+	case RouteAirway:
+		return "airway"
+	case RouteProcedure:
+		return "procedure"
+	case RouteCoordinate:
+		return "coordinate"
+	case RouteDirect:
+		return "direct"
+	default:
+		return "unknown"
+	}
+}
+
+// A RouteElement is a single element of a textual route.
+type RouteElement struct {
+	// Kind classifies the element.
+	Kind RouteElementKind
+	// Text is the element as it appeared in the route. For a coordinate in the Firehose "L lat lon" form, this
+	// includes all three parts.
+	Text string
+	// Lat and Lon are the coordinates of a RouteCoordinate element, in decimal degrees. They are zero for other kinds.
+	Lat, Lon float64
+}
+
+// ParseRoute splits a space-separated textual route, such as PositionMessage.Route or FlightPlanMessage.Route, into
+// its elements and classifies each of them.
+//
+// Routes do not indicate the kind of each element, so elements other than coordinates and "DCT" are classified by
+// their shape alone: for example, a four-letter element is assumed to be an airport. Elements which match none of the
+// recognized shapes are returned as RouteUnknown rather than dropped, so that the route can always be reassembled from
+// the Text of its elements.
+func ParseRoute(route string) []RouteElement {
+	fields := strings.Fields(route)
+	elements := make([]RouteElement, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "L" && i+2 < len(fields) {
+			lat, latErr := strconv.ParseFloat(fields[i+1], 64)
+			lon, lonErr := strconv.ParseFloat(fields[i+2], 64)
+			if latErr == nil && lonErr == nil {
+				elements = append(elements, RouteElement{
+					Kind: RouteCoordinate,
+					Text: strings.Join(fields[i:i+3], " "),
+					Lat:  lat,
+					Lon:  lon,
+				})
+				i += 2
+				continue
+			}
+		}
+		elements = append(elements, parseRouteElement(fields[i]))
+	}
+	return elements
+}
+
+// parseRouteElement classifies a single route element by its shape.
+func parseRouteElement(text string) RouteElement {
+	e := RouteElement{Text: text}
+	s := strings.ToUpper(text)
+	letters, digits, suffix := routeShape(s)
+	switch {
+	case s == "DCT":
+		e.Kind = RouteDirect
+	case digits == 0 && suffix == 0 && letters == 4:
+		e.Kind = RouteAirport
+	case digits == 0 && suffix == 0 && (letters == 2 || letters == 3):
+		e.Kind = RouteNavaid
+	case digits == 0 && suffix == 0 && letters == 5:
+		e.Kind = RouteFix
+	case letters >= 1 && letters <= 2 && digits >= 1 && digits <= 4 && suffix <= 1:
+		e.Kind = RouteAirway
+	case letters >= 3 && letters <= 6 && digits == 1 && suffix <= 1:
+		e.Kind = RouteProcedure
+	default:
+		if lat, lon, ok := parseDegreesMinutes(s); ok {
+			e.Kind = RouteCoordinate
+			e.Lat, e.Lon = lat, lon
+		}
+	}
+	return e
+}
+
+// routeShape reports the lengths of the runs of letters, digits, and letters again which make up s, in that order. If s
+// has any other shape, all three are zero.
+func routeShape(s string) (letters, digits, suffix int) {
+	i := 0
+	for i < len(s) && isUpper(s[i]) {
+		i++
+	}
+	letters = i
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	digits = i - letters
+	for i < len(s) && isUpper(s[i]) {
+		i++
+	}
+	suffix = i - letters - digits
+	if i != len(s) {
+		return 0, 0, 0
+	}
+	return letters, digits, suffix
+}
+
+// parseDegreesMinutes parses a coordinate in the form DDMMNDDDMMW, or DDNDDDW with whole degrees only.
+func parseDegreesMinutes(s string) (lat, lon float64, ok bool) {
+	ns := strings.IndexAny(s, "NS")
+	if ns != 2 && ns != 4 {
+		return 0, 0, false
+	}
+	// The longitude has one more digit of degrees than the latitude, and is followed by E or W.
+	ew := len(s) - 1
+	if len(s) != 2*ns+3 || (s[ew] != 'E' && s[ew] != 'W') {
+		return 0, 0, false
+	}
+	lat, latOK := degreesMinutes(s[:ns])
+	lon, lonOK := degreesMinutes(s[ns+1 : ew])
+	if !latOK || !lonOK || lat > 90 || lon > 180 {
+		return 0, 0, false
+	}
+	if s[ns] == 'S' {
+		lat = -lat
+	}
+	if s[ew] == 'W' {
+		lon = -lon
+	}
+	return lat, lon, true
+}
+
+// degreesMinutes parses whole degrees optionally followed by two digits of minutes.
+func degreesMinutes(s string) (float64, bool) {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return 0, false
+		}
+	}
+	minutes := 0
+	if len(s) >= 4 {
+		minutes, _ = strconv.Atoi(s[len(s)-2:])
+		s = s[:len(s)-2]
+	}
+	degrees, err := strconv.Atoi(s)
+	if err != nil || minutes >= 60 {
+		return 0, false
+	}
+	return float64(degrees) + float64(minutes)/60, true
+}
+
+func isUpper(b byte) bool { return b >= 'A' && b <= 'Z' }
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// A Place is the origin or destination of a flight: usually an airport, but a flight which does not depart from or
+// arrive at a known airport is given as a coordinate instead.
+type Place struct {
+	// Code is the airport code or other identifier of the place, or empty if the place is a coordinate.
+	Code string
+	// IsCoordinate indicates that the place is given by Lat and Lon rather than by Code.
+	IsCoordinate bool
+	// Lat and Lon are the coordinates of the place in decimal degrees, if IsCoordinate is set.
+	Lat, Lon float64
+}
+
+// parsePlace interprets an origin or destination field, which holds either an identifier or a coordinate in the form
+// "L lat lon". It reports false if the field is empty or is a coordinate which cannot be parsed.
+func parsePlace(s string) (Place, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Place{}, false
+	}
+	rest, isCoordinate := strings.CutPrefix(s, "L ")
+	if !isCoordinate {
+		return Place{Code: s}, true
+	}
+	fields := strings.Fields(rest)
+	if len(fields) != 2 {
+		return Place{}, false
+	}
+	lat, latErr := strconv.ParseFloat(fields[0], 64)
+	lon, lonErr := strconv.ParseFloat(fields[1], 64)
+	if latErr != nil || lonErr != nil || !(lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180) {
+		return Place{}, false
+	}
+	return Place{IsCoordinate: true, Lat: lat, Lon: lon}, true
+}
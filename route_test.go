@@ -0,0 +1,93 @@
+package firehose_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestParseRoute(t *testing.T) {
+	route := "KBOS MERIT5 MERIT J75 BOS DCT L 9.13179 -81.43443 4230N07100W ROBUC3 KLAX ?!"
+	elements := firehose.ParseRoute(route)
+	expected := []struct {
+		kind firehose.RouteElementKind
+		text string
+	}{
+		{firehose.RouteAirport, "KBOS"},
+		{firehose.RouteProcedure, "MERIT5"},
+		{firehose.RouteFix, "MERIT"},
+		{firehose.RouteAirway, "J75"},
+		{firehose.RouteNavaid, "BOS"},
+		{firehose.RouteDirect, "DCT"},
+		{firehose.RouteCoordinate, "L 9.13179 -81.43443"},
+		{firehose.RouteCoordinate, "4230N07100W"},
+		{firehose.RouteProcedure, "ROBUC3"},
+		{firehose.RouteAirport, "KLAX"},
+		{firehose.RouteUnknown, "?!"},
+	}
+	if len(elements) != len(expected) {
+		t.Fatalf("expected %d elements, got %d: %+v", len(expected), len(elements), elements)
+	}
+	texts := make([]string, len(elements))
+	for i, e := range elements {
+		if e.Kind != expected[i].kind || e.Text != expected[i].text {
+			t.Errorf("element %d: expected %s %q, got %s %q", i, expected[i].kind, expected[i].text, e.Kind, e.Text)
+		}
+		texts[i] = e.Text
+	}
+	if strings.Join(texts, " ") != route {
+		t.Errorf("route could not be reassembled: %s", strings.Join(texts, " "))
+	}
+
+	if e := elements[6]; e.Lat != 9.13179 || e.Lon != -81.43443 {
+		t.Errorf("unexpected coordinate: %v, %v", e.Lat, e.Lon)
+	}
+	if e := elements[7]; e.Lat != 42.5 || e.Lon != -71 {
+		t.Errorf("unexpected coordinate: %v, %v", e.Lat, e.Lon)
+	}
+	if elements := firehose.ParseRoute("L 12"); len(elements) != 2 || elements[0].Kind != firehose.RouteUnknown {
+		t.Errorf("expected incomplete coordinate to be left unclassified, got: %+v", elements)
+	}
+}
+
+func TestParseRouteMalformedCoordinates(t *testing.T) {
+	for _, text := range []string{"12N", "12S", "4230N", "4230N071", "4230N07100", "4230N0710W", "4230N071000W", "42N07100W", "4230N07100X"} {
+		elements := firehose.ParseRoute(text)
+		if len(elements) != 1 || elements[0].Kind != firehose.RouteUnknown || elements[0].Text != text {
+			t.Errorf("expected %q to be left unclassified, got: %+v", text, elements)
+		}
+	}
+	if elements := firehose.ParseRoute("12N130W"); len(elements) != 1 || elements[0].Lat != 12 || elements[0].Lon != -130 {
+		t.Errorf("unexpected whole-degree coordinate: %+v", elements)
+	}
+}
+
+func TestPositionPlaces(t *testing.T) {
+	pos := firehose.PositionMessage{Orig: "L 9.13179 -81.43443", Dest: "MPTO"}
+	orig, ok := pos.Origin()
+	if !ok || !orig.IsCoordinate || orig.Code != "" || orig.Lat != 9.13179 || orig.Lon != -81.43443 {
+		t.Errorf("unexpected origin: %+v, %t", orig, ok)
+	}
+	dest, ok := pos.Destination()
+	if !ok || dest.IsCoordinate || dest.Code != "MPTO" {
+		t.Errorf("unexpected destination: %+v, %t", dest, ok)
+	}
+	if _, ok := (firehose.PositionMessage{}).Origin(); ok {
+		t.Errorf("expected missing origin")
+	}
+
+	for _, place := range []string{"L 9.13179", "L 9.13179 -81.43443 12", "L north -81.43443", "L 91 0"} {
+		pos := firehose.PositionMessage{Orig: place, Dest: place}
+		if orig, ok := pos.Origin(); ok {
+			t.Errorf("expected malformed origin %q to be rejected, got: %+v", place, orig)
+		}
+		if dest, ok := pos.Destination(); ok {
+			t.Errorf("expected malformed destination %q to be rejected, got: %+v", place, dest)
+		}
+	}
+	// An identifier resembling a truncated coordinate is not a coordinate.
+	if orig, ok := (firehose.PositionMessage{Orig: "4230N"}).Origin(); !ok || orig.IsCoordinate || orig.Code != "4230N" {
+		t.Errorf("unexpected origin: %+v, %t", orig, ok)
+	}
+}
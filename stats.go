@@ -0,0 +1,68 @@
+package firehose
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats holds counters describing the data read from a Stream.
+type Stats struct {
+	// BytesRead is the number of bytes read from the connection, before any decompression.
+	BytesRead int64
+	// MessagesDecoded is the number of messages successfully decoded.
+	MessagesDecoded int64
+	// MessagesByType holds the number of messages successfully decoded of each type, keyed by the type field.
+	MessagesByType map[string]int64
+	// ClockRegressions is the number of position messages found to go back in time by WithClockCheck.
+	ClockRegressions int64
+}
+
+// streamStats accumulates the counters reported by Stream.Stats. It is safe for concurrent use, so that Stats can be
+// called while another goroutine reads from the Stream.
+type streamStats struct {
+	bytesRead        atomic.Int64
+	clockRegressions atomic.Int64
+
+	mu       sync.Mutex
+	messages int64
+	byType   map[string]int64
+}
+
+// countMessage records a successfully decoded message of the given type.
+func (s *streamStats) countMessage(typ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byType == nil {
+		s.byType = make(map[string]int64)
+	}
+	s.messages++
+	s.byType[typ]++
+}
+
+func (s *streamStats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byType := make(map[string]int64, len(s.byType))
+	for typ, n := range s.byType {
+		byType[typ] = n
+	}
+	return Stats{
+		BytesRead:        s.bytesRead.Load(),
+		MessagesDecoded:  s.messages,
+		MessagesByType:   byType,
+		ClockRegressions: s.clockRegressions.Load(),
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,32 @@
+package firehose_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestStats(t *testing.T) {
+	data := `{"type":"position","ident":"A"}
+{"type":"position","ident":"B"}
+{"type":"keepalive","serverTime":"1"}
+not json
+`
+	stream := firehose.NewReader(strings.NewReader(data))
+	for i := 0; i < 4; i++ {
+		stream.NextMessage(context.Background())
+	}
+
+	stats := stream.Stats()
+	if stats.BytesRead != int64(len(data)) {
+		t.Errorf("expected %d bytes read, got %d", len(data), stats.BytesRead)
+	}
+	if stats.MessagesDecoded != 3 {
+		t.Errorf("expected 3 messages decoded, got %d", stats.MessagesDecoded)
+	}
+	if stats.MessagesByType["position"] != 2 || stats.MessagesByType["keepalive"] != 1 || len(stats.MessagesByType) != 2 {
+		t.Errorf("unexpected counts by type: %v", stats.MessagesByType)
+	}
+}
@@ -0,0 +1,58 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+)
+
+// Subscribe opens a Stream for cmd with OpenStream and delivers every message received on the returned message
+// channel, for programs which only need to consume a single stream:
+//
+//	msgs, errc := firehose.Subscribe(ctx, cmd)
+//	for msg := range msgs {
+//		// ...
+//	}
+//	if err := <-errc; err != nil {
+//		log.Fatal(err)
+//	}
+//
+// The message channel is closed when the stream ends, after which the error channel yields the reason, including a
+// failure to validate cmd, connect, or send it, and is then closed. No error is yielded if the server finishes sending
+// a requested Range, but any other disconnection is reported, typically as io.EOF. The connection is closed once ctx
+// is done, ending the stream with the context's error.
+func Subscribe(ctx context.Context, cmd InitCommand, opts ...Option) (<-chan *Message, <-chan error) {
+	msgs := make(chan *Message)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(msgs)
+		if err := subscribe(ctx, cmd, opts, msgs); err != nil {
+			errc <- err
+		}
+	}()
+	return msgs, errc
+}
+
+// subscribe runs a Subscribe stream until it ends, returning the error to report.
+func subscribe(ctx context.Context, cmd InitCommand, opts []Option, msgs chan<- *Message) error {
+	stream, err := OpenStream(ctx, cmd, opts...)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for {
+		msg, err := stream.NextMessage(ctx)
+		if errors.Is(err, ErrRangeComplete) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case msgs <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package firehose_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/benburwell/firehose"
+	"github.com/benburwell/firehose/firehosetest"
+)
+
+func TestSubscribe(t *testing.T) {
+	srv := firehosetest.NewServer(
+		`{"type":"position","ident":"A1","pitr":"1000"}`,
+		`{"type":"position","ident":"A2","pitr":"1001"}`,
+	)
+	defer srv.Close()
+
+	cmd := firehose.InitCommand{Live: true, Username: "un", Password: "pw"}
+	msgs, errc := firehose.Subscribe(context.Background(), cmd, srv.Options()...)
+	var idents []string
+	for msg := range msgs {
+		idents = append(idents, msg.Payload.(firehose.PositionMessage).Ident)
+	}
+	if len(idents) != 2 || idents[0] != "A1" || idents[1] != "A2" {
+		t.Errorf("unexpected messages: %v", idents)
+	}
+	if err := <-errc; !errors.Is(err, io.EOF) {
+		t.Errorf("expected the disconnection to be reported, got: %v", err)
+	}
+	if inits := srv.Inits(); len(inits) != 1 || inits[0] != cmd.String() {
+		t.Errorf("unexpected init commands: %q", inits)
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	_, errc := firehose.Subscribe(context.Background(), firehose.InitCommand{Live: true})
+	if err := <-errc; !errors.Is(err, firehose.ErrInvalidInitCommand) {
+		t.Errorf("expected ErrInvalidInitCommand, got: %v", err)
+	}
+
+	srv := firehosetest.NewServerFunc(func(c *firehosetest.Conn) {
+		c.Read(make([]byte, 1))
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs, errc := firehose.Subscribe(ctx, firehose.InitCommand{Live: true, Username: "un", Password: "pw"}, srv.Options()...)
+	cancel()
+	for range msgs {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context's error, got: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package firehose
+
+import (
+	"io"
+	"sync"
+)
+
+// teeBufferLines is the number of lines a tee holds while waiting for its writer.
+const teeBufferLines = 1024
+
+// A tee copies the lines read by a Stream to a writer from a background goroutine, so that a slow writer does not
+// delay decoding.
+type tee struct {
+	lines chan []byte
+	done  chan struct{}
+	once  sync.Once
+	err   error
+}
+
+func newTee(w io.Writer) *tee {
+	t := &tee{
+		lines: make(chan []byte, teeBufferLines),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		for line := range t.lines {
+			if t.err != nil {
+				continue
+			}
+			_, t.err = w.Write(line)
+		}
+	}()
+	return t
+}
+
+// write queues a copy of line, followed by a newline, to be written.
+func (t *tee) write(line []byte) {
+	buf := make([]byte, len(line)+1)
+	copy(buf, line)
+	buf[len(line)] = '\n'
+	t.lines <- buf
+}
+
+// close waits for all queued lines to be written and returns the first error encountered while writing them.
+func (t *tee) close() error {
+	t.once.Do(func() { close(t.lines) })
+	<-t.done
+	return t.err
+}
@@ -0,0 +1,38 @@
+package firehose
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// pinCertificates returns a copy of config which additionally requires the peer's certificate chain to include one of
+// the pinned DER certificates. A nil config is treated as the default configuration.
+func pinCertificates(config *tls.Config, pins [][]byte) *tls.Config {
+	config = cloneConfig(config)
+	verify := config.VerifyPeerCertificate
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if verify != nil {
+			if err := verify(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		for _, raw := range rawCerts {
+			for _, pin := range pins {
+				if bytes.Equal(raw, pin) {
+					return nil
+				}
+			}
+		}
+		return ErrCertificateNotPinned
+	}
+	return config
+}
+
+// cloneConfig returns a copy of config which can be modified, treating nil as the default configuration.
+func cloneConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		return &tls.Config{}
+	}
+	return config.Clone()
+}
@@ -0,0 +1,125 @@
+package firehose
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A TrackBuilder assembles the position reports of each flight, grouped by flight ID and ordered by Clock, into the
+// path the flight has flown.
+//
+// A flight's track is complete once it reports a position on the ground after having been airborne. The completed
+// track, including the ground position, is passed to the callback registered with OnTrack and then discarded, so that
+// memory is only held for flights in progress. Tracks of flights which never land, for example because they leave the
+// area covered by the stream's filters, can be discarded with Forget or ExpireBefore.
+//
+// A TrackBuilder is safe for concurrent use, and the callback is invoked without holding its lock.
+type TrackBuilder struct {
+	mu      sync.Mutex
+	tracks  map[string]*track
+	onTrack func(id string, positions []PositionMessage)
+}
+
+// track holds the positions recorded so far for a flight.
+type track struct {
+	positions []PositionMessage
+	times     []time.Time
+	airborne  bool
+}
+
+// NewTrackBuilder creates an empty TrackBuilder.
+func NewTrackBuilder() *TrackBuilder {
+	return &TrackBuilder{
+		tracks: make(map[string]*track),
+	}
+}
+
+// OnTrack registers a callback which is invoked with each track once it is complete.
+func (b *TrackBuilder) OnTrack(fn func(id string, positions []PositionMessage)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onTrack = fn
+}
+
+// Observe adds the position reported by a position message. Other messages are ignored.
+func (b *TrackBuilder) Observe(msg *Message) {
+	if pos, ok := msg.Payload.(PositionMessage); ok {
+		b.Add(pos)
+	}
+}
+
+// Add records a position in its flight's track. Positions without an ID or a valid Clock are ignored. A position
+// reported out of order is inserted at its place in the track, and one with the same Clock as a position already in
+// the track is placed after it. Only a ground position which is the latest in its track completes the track.
+func (b *TrackBuilder) Add(pos PositionMessage) {
+	at, err := pos.Time()
+	if pos.ID == "" || err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	t, ok := b.tracks[pos.ID]
+	if !ok {
+		t = &track{}
+		b.tracks[pos.ID] = t
+	}
+	i := sort.Search(len(t.times), func(i int) bool { return t.times[i].After(at) })
+	t.times = append(t.times, time.Time{})
+	copy(t.times[i+1:], t.times[i:])
+	t.times[i] = at
+	t.positions = append(t.positions, PositionMessage{})
+	copy(t.positions[i+1:], t.positions[i:])
+	t.positions[i] = pos
+
+	landed := false
+	switch pos.AirGround {
+	case AirGroundAir:
+		t.airborne = true
+	case AirGroundGround, AirGroundWOW:
+		landed = t.airborne && i == len(t.positions)-1
+	}
+	if landed {
+		delete(b.tracks, pos.ID)
+	}
+	onTrack := b.onTrack
+	b.mu.Unlock()
+
+	if landed && onTrack != nil {
+		onTrack(pos.ID, t.positions)
+	}
+}
+
+// Track returns the positions recorded so far for the flight with the given ID, in order. It returns nil if the flight
+// has no track in progress.
+func (b *TrackBuilder) Track(id string) []PositionMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.tracks[id]
+	if !ok {
+		return nil
+	}
+	return append([]PositionMessage(nil), t.positions...)
+}
+
+// Forget discards the track of the flight with the given ID.
+func (b *TrackBuilder) Forget(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.tracks, id)
+}
+
+// ExpireBefore discards every track whose most recent position was reported before cutoff, returning the number of
+// tracks discarded. The callback registered with OnTrack is not invoked for them.
+func (b *TrackBuilder) ExpireBefore(cutoff time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	expired := 0
+	for id, t := range b.tracks {
+		if t.times[len(t.times)-1].Before(cutoff) {
+			delete(b.tracks, id)
+			expired++
+		}
+	}
+	return expired
+}
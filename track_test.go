@@ -0,0 +1,45 @@
+package firehose_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestTrackBuilder(t *testing.T) {
+	b := firehose.NewTrackBuilder()
+	var completed [][]firehose.PositionMessage
+	b.OnTrack(func(id string, positions []firehose.PositionMessage) {
+		if id != "F1" {
+			t.Errorf("unexpected completed track: %s", id)
+		}
+		completed = append(completed, positions)
+	})
+
+	b.Observe(position("F1", "100", firehose.AirGroundGround))
+	b.Observe(position("F1", "300", firehose.AirGroundAir))
+	b.Observe(position("F1", "200", firehose.AirGroundAir))
+	b.Observe(position("F2", "150", firehose.AirGroundAir))
+	b.Observe(position("F1", "", firehose.AirGroundAir))
+
+	track := b.Track("F1")
+	if len(track) != 3 || track[0].Clock != "100" || track[1].Clock != "200" || track[2].Clock != "300" {
+		t.Fatalf("unexpected track: %+v", track)
+	}
+
+	b.Observe(position("F1", "400", firehose.AirGroundWOW))
+	if len(completed) != 1 || len(completed[0]) != 4 || completed[0][3].Clock != "400" {
+		t.Fatalf("expected completed track of 4 positions, got: %+v", completed)
+	}
+	if b.Track("F1") != nil {
+		t.Errorf("completed track was retained")
+	}
+
+	if n := b.ExpireBefore(time.Unix(100, 0)); n != 0 {
+		t.Errorf("expected no tracks to expire, got %d", n)
+	}
+	if n := b.ExpireBefore(time.Unix(200, 0)); n != 1 || b.Track("F2") != nil {
+		t.Errorf("expected stale track to expire, got %d", n)
+	}
+}
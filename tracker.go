@@ -0,0 +1,154 @@
+package firehose
+
+import (
+	"sync"
+	"time"
+)
+
+// A Tracker maintains the most recent position of each flight seen on a Firehose stream.
+//
+// Flights which have not been updated within the Tracker's TTL are evicted by Prune. Times are taken from the Clock
+// field of each position rather than from the wall clock, so a Tracker behaves the same way when it is fed replayed
+// data as it does with a live stream.
+//
+// A Tracker is safe for concurrent use. Callbacks registered with OnNewFlight and OnFlightLost are invoked
+// synchronously from Update and Prune after the Tracker's internal lock has been released, so a callback may safely
+// call back into the Tracker. Callbacks triggered by concurrent calls to Update or Prune may themselves run
+// concurrently and in any order.
+type Tracker struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	flights map[string]*trackedFlight
+	onNew   func(PositionMessage)
+	onLost  func(id string, last PositionMessage)
+}
+
+type trackedFlight struct {
+	last PositionMessage
+	seen time.Time
+	// since is the Clock of the first position in the current run of continuous coverage.
+	since time.Time
+}
+
+// NewTracker creates a Tracker which forgets flights that have not reported a position within ttl.
+func NewTracker(ttl time.Duration) *Tracker {
+	return &Tracker{
+		ttl:     ttl,
+		flights: make(map[string]*trackedFlight),
+	}
+}
+
+// OnNewFlight registers a callback which is invoked with the first position received for each flight.
+//
+// A flight which is evicted and later reappears is reported again.
+func (t *Tracker) OnNewFlight(fn func(PositionMessage)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onNew = fn
+}
+
+// OnFlightLost registers a callback which is invoked when a flight is evicted by Prune. The callback receives the
+// flight ID and the last position that was received for the flight.
+func (t *Tracker) OnFlightLost(fn func(id string, last PositionMessage)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onLost = fn
+}
+
+// Update records a position report.
+//
+// Positions without a flight ID or with an unparseable Clock are ignored, as are positions which are older than the
+// one already recorded for the flight.
+func (t *Tracker) Update(p PositionMessage) {
+	if p.ID == "" {
+		return
+	}
+	clock, err := parseEpoch(p.Clock)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	f, ok := t.flights[p.ID]
+	if ok {
+		if !clock.Before(f.seen) {
+			if clock.Sub(f.seen) > t.ttl {
+				f.since = clock
+			}
+			f.last = p
+			f.seen = clock
+		}
+		t.mu.Unlock()
+		return
+	}
+	t.flights[p.ID] = &trackedFlight{last: p, seen: clock, since: clock}
+	onNew := t.onNew
+	t.mu.Unlock()
+
+	if onNew != nil {
+		onNew(p)
+	}
+}
+
+// Get returns the most recent position recorded for the flight with the given ID.
+func (t *Tracker) Get(id string) (PositionMessage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.flights[id]
+	if !ok {
+		return PositionMessage{}, false
+	}
+	return f.last, true
+}
+
+// CoverageDuration returns how long the flight with the given ID has been continuously observed, measured from the
+// Clock of the first position in the current run of coverage to the Clock of the most recent one.
+//
+// A gap between consecutive positions longer than the TTL ends a run of coverage, and the duration starts again
+// from zero.
+func (t *Tracker) CoverageDuration(id string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.flights[id]
+	if !ok {
+		return 0, false
+	}
+	return f.seen.Sub(f.since), true
+}
+
+// Len returns the number of flights currently being tracked.
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.flights)
+}
+
+// Prune evicts every flight whose most recent position is older than the TTL relative to now.
+//
+// When consuming a live stream, now will typically be time.Now(). When replaying historical data, pass the Clock of
+// the latest message processed instead.
+func (t *Tracker) Prune(now time.Time) {
+	type lostFlight struct {
+		id   string
+		last PositionMessage
+	}
+	var lost []lostFlight
+
+	t.mu.Lock()
+	for id, f := range t.flights {
+		if now.Sub(f.seen) > t.ttl {
+			delete(t.flights, id)
+			lost = append(lost, lostFlight{id: id, last: f.last})
+		}
+	}
+	onLost := t.onLost
+	t.mu.Unlock()
+
+	if onLost == nil {
+		return
+	}
+	for _, l := range lost {
+		onLost(l.id, l.last)
+	}
+}
@@ -0,0 +1,86 @@
+package firehose_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestTrackerNewFlight(t *testing.T) {
+	tracker := firehose.NewTracker(time.Minute)
+	var seen []string
+	tracker.OnNewFlight(func(p firehose.PositionMessage) {
+		seen = append(seen, p.ID)
+		// Calling back into the tracker must not deadlock.
+		if _, ok := tracker.Get(p.ID); !ok {
+			t.Errorf("new flight %s not yet stored when callback ran", p.ID)
+		}
+	})
+
+	tracker.Update(firehose.PositionMessage{ID: "a", Clock: "100"})
+	tracker.Update(firehose.PositionMessage{ID: "a", Clock: "110"})
+	tracker.Update(firehose.PositionMessage{ID: "b", Clock: "120"})
+
+	if len(seen) != 2 || seen[0] != "a" || seen[1] != "b" {
+		t.Errorf("unexpected new flights: %v", seen)
+	}
+	if tracker.Len() != 2 {
+		t.Errorf("expected 2 tracked flights, got %d", tracker.Len())
+	}
+	if p, _ := tracker.Get("a"); p.Clock != "110" {
+		t.Errorf("expected latest position for a, got clock %s", p.Clock)
+	}
+}
+
+func TestTrackerFlightLost(t *testing.T) {
+	tracker := firehose.NewTracker(time.Minute)
+	lost := make(map[string]firehose.PositionMessage)
+	tracker.OnFlightLost(func(id string, last firehose.PositionMessage) {
+		lost[id] = last
+		if _, ok := tracker.Get(id); ok {
+			t.Errorf("lost flight %s still tracked when callback ran", id)
+		}
+	})
+
+	tracker.Update(firehose.PositionMessage{ID: "a", Clock: "100", Ident: "ABC1"})
+	tracker.Update(firehose.PositionMessage{ID: "b", Clock: "150"})
+
+	tracker.Prune(time.Unix(170, 0))
+	if _, ok := lost["a"]; !ok {
+		t.Fatalf("expected flight a to be lost")
+	}
+	if lost["a"].Ident != "ABC1" {
+		t.Errorf("unexpected last position: %#v", lost["a"])
+	}
+	if _, ok := lost["b"]; ok {
+		t.Errorf("flight b should not have been lost")
+	}
+	if tracker.Len() != 1 {
+		t.Errorf("expected 1 tracked flight, got %d", tracker.Len())
+	}
+}
+
+func TestTrackerCoverageDuration(t *testing.T) {
+	tracker := firehose.NewTracker(time.Minute)
+	if _, ok := tracker.CoverageDuration("a"); ok {
+		t.Errorf("expected no coverage for unknown flight")
+	}
+
+	for _, clock := range []string{"1000", "1030", "1060", "1090"} {
+		tracker.Update(firehose.PositionMessage{ID: "a", Clock: clock})
+	}
+	if d, ok := tracker.CoverageDuration("a"); !ok || d != 90*time.Second {
+		t.Errorf("unexpected coverage before gap: %v, %t", d, ok)
+	}
+
+	// A gap longer than the TTL restarts the coverage run.
+	tracker.Update(firehose.PositionMessage{ID: "a", Clock: "1300"})
+	if d, _ := tracker.CoverageDuration("a"); d != 0 {
+		t.Errorf("expected coverage to reset after gap, got %v", d)
+	}
+	tracker.Update(firehose.PositionMessage{ID: "a", Clock: "1345"})
+	if d, _ := tracker.CoverageDuration("a"); d != 45*time.Second {
+		t.Errorf("unexpected coverage after gap: %v", d)
+	}
+}
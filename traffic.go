@@ -0,0 +1,136 @@
+package firehose
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// AirportTraffic holds the number of movements counted at an airport.
+type AirportTraffic struct {
+	// Departures is the number of flights which departed from the airport.
+	Departures int
+	// Arrivals is the number of flights which arrived at the airport.
+	Arrivals int
+}
+
+// A TrafficCounter tallies departures and arrivals per airport over a sliding time window.
+//
+// The window is measured back from the time of the most recent movement recorded rather than from the wall clock, so
+// a TrafficCounter gives the same results for replayed data as for a live stream. Movements which fall outside the
+// window are discarded.
+//
+// A TrafficCounter is safe for concurrent use.
+type TrafficCounter struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	movements movementHeap
+	latest    time.Time
+	counts    map[string]AirportTraffic
+}
+
+// NewTrafficCounter creates a TrafficCounter which counts movements within the given window.
+func NewTrafficCounter(window time.Duration) *TrafficCounter {
+	return &TrafficCounter{
+		window: window,
+		counts: make(map[string]AirportTraffic),
+	}
+}
+
+// RecordDeparture counts a departure from the airport at the given time.
+func (tc *TrafficCounter) RecordDeparture(airport string, at time.Time) {
+	tc.record(movement{airport: airport, at: at, departure: true})
+}
+
+// RecordArrival counts an arrival at the airport at the given time.
+func (tc *TrafficCounter) RecordArrival(airport string, at time.Time) {
+	tc.record(movement{airport: airport, at: at})
+}
+
+// Observe counts the movement reported by a departure or arrival message. Departures are counted at their origin
+// and arrivals at their destination. Other messages are ignored.
+func (tc *TrafficCounter) Observe(msg *Message) {
+	switch m := msg.Payload.(type) {
+	case DepartureMessage:
+		if at, err := parseEpoch(m.ADT); err == nil {
+			tc.RecordDeparture(m.Orig, at)
+		}
+	case ArrivalMessage:
+		if at, err := parseEpoch(m.AAT); err == nil {
+			tc.RecordArrival(m.Dest, at)
+		}
+	}
+}
+
+// Counts returns the movements counted at each airport within the current window, keyed by airport code. Airports
+// without any movements in the window are omitted.
+func (tc *TrafficCounter) Counts() map[string]AirportTraffic {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	counts := make(map[string]AirportTraffic, len(tc.counts))
+	for airport, traffic := range tc.counts {
+		counts[airport] = traffic
+	}
+	return counts
+}
+
+func (tc *TrafficCounter) record(m movement) {
+	if m.airport == "" {
+		return
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if m.at.After(tc.latest) {
+		tc.latest = m.at
+	}
+	cutoff := tc.latest.Add(-tc.window)
+	if m.at.Before(cutoff) {
+		return
+	}
+	heap.Push(&tc.movements, m)
+	tc.adjust(m, 1)
+
+	for len(tc.movements) > 0 && tc.movements[0].at.Before(cutoff) {
+		tc.adjust(heap.Pop(&tc.movements).(movement), -1)
+	}
+}
+
+// adjust applies delta to the count for the movement's airport.
+func (tc *TrafficCounter) adjust(m movement, delta int) {
+	traffic := tc.counts[m.airport]
+	if m.departure {
+		traffic.Departures += delta
+	} else {
+		traffic.Arrivals += delta
+	}
+	if traffic == (AirportTraffic{}) {
+		delete(tc.counts, m.airport)
+		return
+	}
+	tc.counts[m.airport] = traffic
+}
+
+// movement is a departure or arrival at an airport.
+type movement struct {
+	airport   string
+	at        time.Time
+	departure bool
+}
+
+// movementHeap orders movements by time, oldest first.
+type movementHeap []movement
+
+func (h movementHeap) Len() int           { return len(h) }
+func (h movementHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h movementHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *movementHeap) Push(x any)        { *h = append(*h, x.(movement)) }
+
+func (h *movementHeap) Pop() any {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
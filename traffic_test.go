@@ -0,0 +1,62 @@
+package firehose_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benburwell/firehose"
+)
+
+func TestTrafficCounter(t *testing.T) {
+	tc := firehose.NewTrafficCounter(time.Hour)
+	base := time.Unix(1000000, 0)
+
+	tc.RecordDeparture("KBOS", base)
+	tc.RecordArrival("KJFK", base.Add(10*time.Minute))
+	tc.RecordDeparture("KBOS", base.Add(20*time.Minute))
+	tc.RecordArrival("KBOS", base.Add(30*time.Minute))
+
+	counts := tc.Counts()
+	if counts["KBOS"] != (firehose.AirportTraffic{Departures: 2, Arrivals: 1}) {
+		t.Errorf("unexpected KBOS traffic: %#v", counts["KBOS"])
+	}
+	if counts["KJFK"] != (firehose.AirportTraffic{Arrivals: 1}) {
+		t.Errorf("unexpected KJFK traffic: %#v", counts["KJFK"])
+	}
+
+	// Advancing the window drops the first departure and the KJFK arrival.
+	tc.RecordDeparture("KLGA", base.Add(75*time.Minute))
+	counts = tc.Counts()
+	if counts["KBOS"] != (firehose.AirportTraffic{Departures: 1, Arrivals: 1}) {
+		t.Errorf("unexpected KBOS traffic after advancing: %#v", counts["KBOS"])
+	}
+	if _, ok := counts["KJFK"]; ok {
+		t.Errorf("expected KJFK to have no traffic in window: %#v", counts["KJFK"])
+	}
+
+	// Movements older than the window are ignored.
+	tc.RecordArrival("KJFK", base)
+	if _, ok := tc.Counts()["KJFK"]; ok {
+		t.Errorf("expected stale arrival to be ignored")
+	}
+}
+
+func TestTrafficCounterObserve(t *testing.T) {
+	tc := firehose.NewTrafficCounter(time.Hour)
+	msgs := []*firehose.Message{
+		{Type: "departure", Payload: firehose.DepartureMessage{Orig: "KBOS", Dest: "KSFO", ADT: "1000"}},
+		{Type: "departure", Payload: firehose.DepartureMessage{Orig: "KBOS", Dest: "KORD", ADT: "1100"}},
+		{Type: "arrival", Payload: firehose.ArrivalMessage{Orig: "KORD", Dest: "KBOS", AAT: "1200"}},
+		{Type: "position", Payload: firehose.PositionMessage{Orig: "KBOS", Dest: "KJFK", Clock: "1300"}},
+	}
+	for _, msg := range msgs {
+		tc.Observe(msg)
+	}
+	counts := tc.Counts()
+	if counts["KBOS"] != (firehose.AirportTraffic{Departures: 2, Arrivals: 1}) {
+		t.Errorf("unexpected KBOS traffic: %#v", counts["KBOS"])
+	}
+	if len(counts) != 1 {
+		t.Errorf("unexpected airports counted: %#v", counts)
+	}
+}